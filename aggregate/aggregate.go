@@ -0,0 +1,134 @@
+// Package aggregate provides type-safe helpers grouping and summarizing
+// slices of any element type by a key.
+package aggregate
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Number is the constraint of the values SumBy adds up.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64
+}
+
+// GroupBy returns the items grouped by the key of each, keeping their order
+// within a group.
+func GroupBy[T any, K comparable](items []T, key func(T) K) map[K][]T {
+	grouped := make(map[K][]T)
+	for _, item := range items {
+		k := key(item)
+		grouped[k] = append(grouped[k], item)
+	}
+	return grouped
+}
+
+// CountBy returns the number of items sharing each key.
+func CountBy[T any, K comparable](items []T, key func(T) K) map[K]int {
+	counts := make(map[K]int)
+	for _, item := range items {
+		counts[key(item)]++
+	}
+	return counts
+}
+
+// SumBy returns the sum of the values of the items sharing each key.
+func SumBy[T any, K comparable, N Number](items []T, key func(T) K, value func(T) N) map[K]N {
+	sums := make(map[K]N)
+	for _, item := range items {
+		sums[key(item)] += value(item)
+	}
+	return sums
+}
+
+// Distinct returns the keys of the items, each once, in the order they are
+// first seen.
+func Distinct[T any, K comparable](items []T, key func(T) K) []K {
+	seen := make(map[K]bool)
+	var keys []K
+	for _, item := range items {
+		k := key(item)
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// TopK returns the k first items in the order defined by less, fewer when
+// less are available. Items equal under less keep their relative order.
+// items is left untouched.
+//
+// Only the k best items seen so far are kept, in a heap whose root is the
+// worst of them, so selecting them takes O(n log k) time and O(k) space
+// rather than sorting every item.
+func TopK[T any](items []T, k int, less func(a, b T) bool) []T {
+	if k <= 0 {
+		return nil
+	}
+	if k >= len(items) {
+		sorted := append([]T(nil), items...)
+		sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+		return sorted
+	}
+
+	h := &topHeap[T]{less: less, entries: make([]topEntry[T], 0, k)}
+	for i, item := range items {
+		e := topEntry[T]{item: item, pos: i}
+		if len(h.entries) < k {
+			heap.Push(h, e)
+			continue
+		}
+		// a later item only displaces the worst kept one when strictly
+		// better, so equal items keep their relative order
+		if less(item, h.entries[0].item) {
+			h.entries[0] = e
+			heap.Fix(h, 0)
+		}
+	}
+
+	top := make([]T, len(h.entries))
+	for i := len(top) - 1; i >= 0; i-- {
+		top[i] = heap.Pop(h).(topEntry[T]).item
+	}
+	return top
+}
+
+// topEntry is an item kept by TopK along with its position in the input.
+type topEntry[T any] struct {
+	item T
+	pos  int
+}
+
+// topHeap implements heap.Interface over the entries kept by TopK, the worst
+// of them at the root.
+type topHeap[T any] struct {
+	less    func(a, b T) bool
+	entries []topEntry[T]
+}
+
+func (h *topHeap[T]) Len() int { return len(h.entries) }
+
+func (h *topHeap[T]) Less(i, j int) bool {
+	ei, ej := h.entries[i], h.entries[j]
+	if h.less(ei.item, ej.item) {
+		return false
+	}
+	if h.less(ej.item, ei.item) {
+		return true
+	}
+	return ei.pos > ej.pos
+}
+
+func (h *topHeap[T]) Swap(i, j int) { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+
+func (h *topHeap[T]) Push(x any) { h.entries = append(h.entries, x.(topEntry[T])) }
+
+func (h *topHeap[T]) Pop() any {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
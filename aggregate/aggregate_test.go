@@ -0,0 +1,179 @@
+package aggregate_test
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dikaeinstein/ghanalytics/aggregate"
+)
+
+type event struct {
+	actor   string
+	commits int
+}
+
+var events = []event{
+	{actor: "alice", commits: 2},
+	{actor: "bob", commits: 1},
+	{actor: "alice", commits: 3},
+	{actor: "carol", commits: 0},
+	{actor: "bob", commits: 4},
+}
+
+func byActor(e event) string { return e.actor }
+
+func TestGroupBy(t *testing.T) {
+	got := aggregate.GroupBy(events, byActor)
+	want := map[string][]event{
+		"alice": {{actor: "alice", commits: 2}, {actor: "alice", commits: 3}},
+		"bob":   {{actor: "bob", commits: 1}, {actor: "bob", commits: 4}},
+		"carol": {{actor: "carol", commits: 0}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong groups returned. want %+v; got %+v", want, got)
+	}
+}
+
+func TestCountBy(t *testing.T) {
+	got := aggregate.CountBy(events, byActor)
+	want := map[string]int{"alice": 2, "bob": 2, "carol": 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong counts returned. want %+v; got %+v", want, got)
+	}
+}
+
+func TestSumBy(t *testing.T) {
+	got := aggregate.SumBy(events, byActor, func(e event) int { return e.commits })
+	want := map[string]int{"alice": 5, "bob": 5, "carol": 0}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong sums returned. want %+v; got %+v", want, got)
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		items []string
+		want  []string
+	}{
+		{
+			desc:  "KeepsFirstSeenOrder",
+			items: []string{"b", "a", "B", "c", "a"},
+			want:  []string{"b", "a", "c"},
+		},
+		{
+			desc:  "Empty",
+			items: nil,
+			want:  nil,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got := aggregate.Distinct(tC.items, strings.ToLower)
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Wrong keys returned. want %+v; got %+v", tC.want, got)
+			}
+		})
+	}
+}
+
+func TestTopK(t *testing.T) {
+	moreCommits := func(a, b event) bool { return a.commits > b.commits }
+
+	testCases := []struct {
+		desc string
+		k    int
+		want []event
+	}{
+		{
+			desc: "FewerThanAvailable",
+			k:    2,
+			want: []event{{actor: "bob", commits: 4}, {actor: "alice", commits: 3}},
+		},
+		{
+			desc: "MoreThanAvailable",
+			k:    10,
+			want: []event{
+				{actor: "bob", commits: 4},
+				{actor: "alice", commits: 3},
+				{actor: "alice", commits: 2},
+				{actor: "bob", commits: 1},
+				{actor: "carol", commits: 0},
+			},
+		},
+		{
+			desc: "Zero",
+			k:    0,
+			want: nil,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			before := append([]event(nil), events...)
+
+			got := aggregate.TopK(events, tC.k, moreCommits)
+			if !reflect.DeepEqual(got, tC.want) {
+				t.Errorf("Wrong items returned. want %+v; got %+v", tC.want, got)
+			}
+			if !reflect.DeepEqual(events, before) {
+				t.Errorf("TopK modified its input: %+v", events)
+			}
+		})
+	}
+}
+
+func TestTopKStable(t *testing.T) {
+	got := aggregate.TopK(events, 2, func(a, b event) bool { return len(a.actor) > len(b.actor) })
+	want := []event{{actor: "alice", commits: 2}, {actor: "alice", commits: 3}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong items returned. want %+v; got %+v", want, got)
+	}
+}
+
+func TestTopKMatchesSort(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	items := make([]event, 1000)
+	for i := range items {
+		// few distinct values, so most items tie
+		items[i] = event{actor: strconv.Itoa(i), commits: rnd.Intn(20)}
+	}
+	moreCommits := func(a, b event) bool { return a.commits > b.commits }
+
+	sorted := append([]event(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return moreCommits(sorted[i], sorted[j]) })
+
+	for _, k := range []int{1, 7, 100, 999, 1000, 2000} {
+		want := sorted
+		if k < len(want) {
+			want = want[:k]
+		}
+		got := aggregate.TopK(items, k, moreCommits)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("TopK(%d) differs from a stable sort. want %+v; got %+v", k, want, got)
+		}
+	}
+}
+
+func BenchmarkTopK(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	items := make([]int, 1_000_000)
+	for i := range items {
+		items[i] = rnd.Int()
+	}
+	greater := func(a, b int) bool { return a > b }
+
+	for _, k := range []int{10, 1000, len(items)} {
+		b.Run(fmt.Sprintf("k=%d", k), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				aggregate.TopK(items, k, greater)
+			}
+		})
+	}
+}
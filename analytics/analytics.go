@@ -2,44 +2,176 @@
 // Github event data.
 package analytics
 
-import "sort"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dikaeinstein/ghanalytics/aggregate"
+)
 
 type Actor struct {
-	ID       uint64
-	Username string
+	ID       uint64 `json:"id"`
+	Username string `json:"username"`
 }
 
 type Event struct {
-	ID      uint64
-	Type    EventType
-	ActorID uint64
-	RepoID  uint64
+	ID      uint64    `json:"id"`
+	Type    EventType `json:"type"`
+	ActorID uint64    `json:"actorId"`
+	RepoID  uint64    `json:"repoId"`
+
+	// CreatedAt is when the event happened. It is the zero time when the
+	// source data carries no timestamp.
+	CreatedAt time.Time `json:"createdAt"`
 }
 
 type Commit struct {
-	Sha     string
-	Message string
-	EventID uint64
+	Sha     string `json:"sha"`
+	Message string `json:"message"`
+	EventID uint64 `json:"eventId"`
 }
 
 type Repo struct {
-	ID   uint64
-	Name string
+	ID   uint64 `json:"id"`
+	Name string `json:"name"`
 }
 
+// Store provides the Github data analyzed. The Get methods scan every
+// record against a predicate, while ForEachEvent and the lookups let the
+// store answer from its indexes.
 type Store interface {
 	GetUsers(f func(Actor) bool) ([]Actor, error)
 	GetEvents(f func(Event) bool) ([]Event, error)
 	GetRepos(f func(Repo) bool) ([]Repo, error)
+	GetCommits(f func(Commit) bool) ([]Commit, error)
+
+	// The Context variants of the scans abort with the context's error
+	// once ctx is done.
+	GetUsersContext(ctx context.Context, f func(Actor) bool) ([]Actor, error)
+	GetEventsContext(ctx context.Context, f func(Event) bool) ([]Event, error)
+	GetReposContext(ctx context.Context, f func(Repo) bool) ([]Repo, error)
+	GetCommitsContext(ctx context.Context, f func(Commit) bool) ([]Commit, error)
+
+	// ForEachEvent calls f with every event matching filter, in the order
+	// GetEvents returns them, along with the number of commits it pushed,
+	// zero for events other than pushes. Events are streamed rather than
+	// collected, so a scan holds no more than f keeps. The scan stops at the
+	// first error f returns, which ForEachEvent returns unless it is
+	// ErrStopScan, and aborts with the context's error once ctx is done.
+	ForEachEvent(ctx context.Context, filter EventFilter, f func(e Event, commits int) error) error
+
+	// GetEventTypes returns the distinct types of the events held, in name
+	// order.
+	GetEventTypes(ctx context.Context) ([]EventType, error)
+
+	// GetUsersByIDs and GetReposByIDs return the users and repositories
+	// with the given IDs, skipping unknown IDs.
+	GetUsersByIDs(ctx context.Context, ids []uint64) ([]Actor, error)
+	GetReposByIDs(ctx context.Context, ids []uint64) ([]Repo, error)
+
+	// GetUsersByNames and GetReposByNames return the users and repositories
+	// with the given usernames or "owner/name" full names, compared
+	// case-insensitively, skipping unknown names.
+	GetUsersByNames(ctx context.Context, names []string) ([]Actor, error)
+	GetReposByNames(ctx context.Context, names []string) ([]Repo, error)
+
+	// GetCommitsByEventIDs returns the commits pushed by the given events.
+	GetCommitsByEventIDs(ctx context.Context, eventIDs []uint64) ([]Commit, error)
+
+	// GetEventTypes and the lookups abort with the context's error once ctx
+	// is done.
 }
 
-//
+// ErrStopScan is returned by the function given to ForEachEvent to end the
+// scan early without error.
+var ErrStopScan = errors.New("stop scan")
+
+// EventFilter describes a subset of events by their indexed attributes.
+// Zero valued fields do not restrict the subset.
+type EventFilter struct {
+	Types   []EventType
+	ActorID uint64
+	RepoID  uint64
+
+	// Since and Until bound the creation time of the events, events
+	// without a timestamp do not match once a bound is set.
+	Since time.Time
+	Until time.Time
+}
+
+// Match reports whether e belongs to the subset described by f.
+func (f EventFilter) Match(e Event) bool {
+	if len(f.Types) > 0 {
+		found := false
+		for _, t := range f.Types {
+			if t == e.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.ActorID != 0 && e.ActorID != f.ActorID {
+		return false
+	}
+	if f.RepoID != 0 && e.RepoID != f.RepoID {
+		return false
+	}
+	if f.Since.IsZero() && f.Until.IsZero() {
+		return true
+	}
+	if e.CreatedAt.IsZero() {
+		return false
+	}
+	if !f.Since.IsZero() && e.CreatedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.CreatedAt.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// ListOptions configures how ListUsers and ListRepos rank their results.
 type ListOptions struct {
 	limit         int
+	offset        int
 	sortCriterion []SortCriteria
+	weights       map[SortCriteria]int
+	tieBreak      TieBreaker
+
+	// since and until bound the time window of the events considered,
+	// the zero time leaves the bound open.
+	since time.Time
+	until time.Time
+
+	// actorID and repoID scope the events considered to a single user or
+	// repository, zero leaves them unscoped.
+	actorID uint64
+	repoID  uint64
+
+	// interval is the width of the buckets returned by Series.
+	interval time.Duration
+
+	// bots selects the actors whose events are ranked, and botPatterns
+	// overrides the default username patterns detecting them.
+	bots        BotFilter
+	botPatterns []*regexp.Regexp
+
+	// approx estimates rankings and distinct counts with sketches.
+	approx bool
 }
 
-// Analytics processes Github event data.
+// Analytics processes Github event data. Options only apply to the call
+// they are given to, and an Analytics is safe for concurrent use by multiple
+// goroutines as long as its Store is.
 type Analytics struct {
 	store       Store
 	listOptions ListOptions
@@ -50,246 +182,708 @@ func New(store Store) *Analytics {
 }
 
 type EventType string
+
+// SortCriteria is a quantity entries are ranked by. Every EventType is also
+// a SortCriteria counting the events of that type, as long as the type is
+// listed by EventTypes or found in the store.
 type SortCriteria string
 
 const (
 	CommitsPushed SortCriteria = "commitsPushed"
 	PrCreated     SortCriteria = "prCreated"
+
+	Pushes         = SortCriteria(PushEvent)
+	Watches        = SortCriteria(WatchEvent)
+	Forks          = SortCriteria(ForkEvent)
+	Issues         = SortCriteria(IssuesEvent)
+	IssueComments  = SortCriteria(IssueCommentEvent)
+	Creates        = SortCriteria(CreateEvent)
+	Deletes        = SortCriteria(DeleteEvent)
+	Releases       = SortCriteria(ReleaseEvent)
+	WikiEdits      = SortCriteria(GollumEvent)
+	MembersAdded   = SortCriteria(MemberEvent)
+	MadePublic     = SortCriteria(PublicEvent)
+	CommitComments = SortCriteria(CommitCommentEvent)
+	ReviewComments = SortCriteria(PullRequestReviewCommentEvent)
 )
 
 const (
-	PullRequestEvent EventType = "PullRequestEvent"
-	PushEvent        EventType = "PushEvent"
-	WatchEvent       EventType = "WatchEvent"
+	PullRequestEvent              EventType = "PullRequestEvent"
+	PushEvent                     EventType = "PushEvent"
+	WatchEvent                    EventType = "WatchEvent"
+	ForkEvent                     EventType = "ForkEvent"
+	IssuesEvent                   EventType = "IssuesEvent"
+	IssueCommentEvent             EventType = "IssueCommentEvent"
+	CreateEvent                   EventType = "CreateEvent"
+	DeleteEvent                   EventType = "DeleteEvent"
+	ReleaseEvent                  EventType = "ReleaseEvent"
+	GollumEvent                   EventType = "GollumEvent"
+	MemberEvent                   EventType = "MemberEvent"
+	PublicEvent                   EventType = "PublicEvent"
+	CommitCommentEvent            EventType = "CommitCommentEvent"
+	PullRequestReviewCommentEvent EventType = "PullRequestReviewCommentEvent"
 )
 
+// EventTypes lists the event types given a constant. Other types found in
+// the data, such as DiscussionEvent, are ranked and reported all the same.
+var EventTypes = []EventType{
+	PullRequestEvent, PushEvent, WatchEvent, ForkEvent, IssuesEvent,
+	IssueCommentEvent, CreateEvent, DeleteEvent, ReleaseEvent, GollumEvent,
+	MemberEvent, PublicEvent, CommitCommentEvent, PullRequestReviewCommentEvent,
+}
+
+// eventTypeName matches the names of GH Archive event types, such as
+// PushEvent or SponsorshipEvent.
+var eventTypeName = regexp.MustCompile(`^[A-Z][A-Za-z]*Event$`)
+
+// EventType returns the type of the events the criteria counts, or an error
+// for criteria that are no event type name. Names missing from EventTypes
+// are checked against the store by the rankings, see SortCriteria.
+func (c SortCriteria) EventType() (EventType, error) {
+	switch c {
+	case CommitsPushed:
+		return PushEvent, nil
+	case PrCreated:
+		return PullRequestEvent, nil
+	}
+
+	if eventTypeName.MatchString(string(c)) {
+		return EventType(c), nil
+	}
+	return "", fmt.Errorf("unknown sort criteria %q", c)
+}
+
+// Limit caps the number of results returned to size, fewer are returned when
+// less are available. Zero, the default, returns every result.
 func Limit(size int) func(*Analytics) error {
 	return func(a *Analytics) error {
 		return a.setListOptionsLimit(size)
 	}
 }
 
+// Offset skips the first n results of the ranking, which combined with Limit
+// pages through it.
+func Offset(n int) func(*Analytics) error {
+	return func(a *Analytics) error {
+		return a.setListOptionsOffset(n)
+	}
+}
+
+// Weights sets how much each criteria contributes to the Total entries are
+// ranked by, the default weight being 1. Criteria besides the ones given to
+// Sort join the score after them. Weights must not be negative.
+func Weights(weights map[SortCriteria]int) func(*Analytics) error {
+	return func(a *Analytics) error {
+		return a.setListOptionsWeights(weights)
+	}
+}
+
+// TieBreaker is the final key ordering entries ranked equally on every sort
+// criteria.
+type TieBreaker string
+
+const (
+	// ByID orders tied entries by ascending ID.
+	ByID TieBreaker = "id"
+	// ByName orders tied entries by username or repository name,
+	// case-insensitively.
+	ByName TieBreaker = "name"
+)
+
+// TieBreak sets the final key ordering tied entries. It defaults to ByID.
+func TieBreak(key TieBreaker) func(*Analytics) error {
+	return func(a *Analytics) error {
+		return a.setListOptionsTieBreak(key)
+	}
+}
+
+// Sort ranks entries by the combined amount of the sort criterion. Ties are
+// broken by each criteria in the given order, then by the TieBreak key.
 func Sort(sortCriterion []SortCriteria) func(*Analytics) error {
 	return func(a *Analytics) error {
 		return a.setListOptionsSortCriterion(sortCriterion)
 	}
 }
 
+// Since restricts the events considered to those created at or after t.
+// Events without a timestamp are excluded once a bound is set.
+func Since(t time.Time) func(*Analytics) error {
+	return func(a *Analytics) error {
+		return a.setListOptionsSince(t)
+	}
+}
+
+// Until restricts the events considered to those created before t.
+// Events without a timestamp are excluded once a bound is set.
+func Until(t time.Time) func(*Analytics) error {
+	return func(a *Analytics) error {
+		return a.setListOptionsUntil(t)
+	}
+}
+
+// ForActor restricts the events considered to those of the user with the
+// given ID.
+func ForActor(id uint64) func(*Analytics) error {
+	return func(a *Analytics) error {
+		return a.setListOptionsActorID(id)
+	}
+}
+
+// ForRepo restricts the events considered to those of the repository with
+// the given ID.
+func ForRepo(id uint64) func(*Analytics) error {
+	return func(a *Analytics) error {
+		return a.setListOptionsRepoID(id)
+	}
+}
+
 func (a *Analytics) setListOptionsLimit(size int) error {
+	if size < 0 {
+		return fmt.Errorf("invalid limit %d: must not be negative", size)
+	}
 	a.listOptions.limit = size
 	return nil
 }
 
+func (a *Analytics) setListOptionsOffset(n int) error {
+	if n < 0 {
+		return fmt.Errorf("invalid offset %d: must not be negative", n)
+	}
+	a.listOptions.offset = n
+	return nil
+}
+
+func (a *Analytics) setListOptionsWeights(weights map[SortCriteria]int) error {
+	for c, weight := range weights {
+		if _, err := c.EventType(); err != nil {
+			return err
+		}
+		if weight < 0 {
+			return fmt.Errorf("invalid weight %d for %s: must not be negative", weight, c)
+		}
+	}
+	a.listOptions.weights = weights
+	return nil
+}
+
+func (a *Analytics) setListOptionsTieBreak(key TieBreaker) error {
+	switch key {
+	case ByID, ByName:
+		a.listOptions.tieBreak = key
+		return nil
+	default:
+		return fmt.Errorf("invalid tie break %q: must be %q or %q", key, ByID, ByName)
+	}
+}
+
 func (a *Analytics) setListOptionsSortCriterion(sortCriterion []SortCriteria) error {
+	for _, c := range sortCriterion {
+		if _, err := c.EventType(); err != nil {
+			return err
+		}
+	}
 	a.listOptions.sortCriterion = sortCriterion
 	return nil
 }
 
-func (a *Analytics) buildList(sortCriterion []SortCriteria) []EventType {
-	sortToEventType := map[SortCriteria]EventType{
-		CommitsPushed:            PushEvent,
-		PrCreated:                PullRequestEvent,
-		SortCriteria(WatchEvent): WatchEvent,
+func (a *Analytics) setListOptionsSince(t time.Time) error {
+	a.listOptions.since = t
+	return nil
+}
+
+func (a *Analytics) setListOptionsUntil(t time.Time) error {
+	a.listOptions.until = t
+	return nil
+}
+
+func (a *Analytics) setListOptionsActorID(id uint64) error {
+	a.listOptions.actorID = id
+	return nil
+}
+
+func (a *Analytics) setListOptionsRepoID(id uint64) error {
+	a.listOptions.repoID = id
+	return nil
+}
+
+// eventFilter returns the EventFilter selecting the events of the given
+// types within the scope and time window of the list options. No types
+// selects events of every type.
+func (a *Analytics) eventFilter(types []EventType) EventFilter {
+	return EventFilter{
+		Types:   types,
+		ActorID: a.listOptions.actorID,
+		RepoID:  a.listOptions.repoID,
+		Since:   a.listOptions.since,
+		Until:   a.listOptions.until,
 	}
+}
 
+func (a *Analytics) buildList(sortCriterion []SortCriteria) []EventType {
 	var filterEventTypes []EventType
 	for _, c := range sortCriterion {
-		filterEventTypes = append(filterEventTypes, sortToEventType[c])
+		// criteria are validated when set
+		evt, _ := c.EventType()
+		filterEventTypes = append(filterEventTypes, evt)
 	}
 
 	return filterEventTypes
 }
 
-func (a *Analytics) parseListOptions(options []func(*Analytics) error) error {
+// checkCriteria returns an OptionError for the first criteria counting an
+// event type neither listed by EventTypes nor found in the store, which is
+// more likely a typo than a type without events. The store is only asked for
+// its types when a criteria is missing from EventTypes.
+func (a *Analytics) checkCriteria(ctx context.Context, criterion []SortCriteria) error {
+	known := make(map[EventType]bool, len(EventTypes))
+	for _, evt := range EventTypes {
+		known[evt] = true
+	}
+
+	var unknown []SortCriteria
+	for _, c := range criterion {
+		// criteria are validated when set
+		if evt, _ := c.EventType(); !known[evt] {
+			unknown = append(unknown, c)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	types, err := a.store.GetEventTypes(ctx)
+	if err != nil {
+		return err
+	}
+	for _, evt := range types {
+		known[evt] = true
+	}
+	for _, c := range unknown {
+		if evt, _ := c.EventType(); !known[evt] {
+			return &OptionError{Err: fmt.Errorf("unknown sort criteria %q", c)}
+		}
+	}
+	return nil
+}
+
+// scoring returns the criteria the Total is computed from, the sort criterion
+// followed by the other weighted criteria in name order, along with the
+// weight of each.
+func (a *Analytics) scoring() ([]SortCriteria, []int) {
+	criterion := append([]SortCriteria{}, a.listOptions.sortCriterion...)
+
+	inSort := make(map[SortCriteria]bool, len(criterion))
+	for _, c := range criterion {
+		inSort[c] = true
+	}
+	var weightedOnly []SortCriteria
+	for c := range a.listOptions.weights {
+		if !inSort[c] {
+			weightedOnly = append(weightedOnly, c)
+		}
+	}
+	sort.Slice(weightedOnly, func(i, j int) bool { return weightedOnly[i] < weightedOnly[j] })
+	criterion = append(criterion, weightedOnly...)
+
+	weights := make([]int, len(criterion))
+	for i, c := range criterion {
+		weight, ok := a.listOptions.weights[c]
+		if !ok {
+			weight = 1
+		}
+		weights[i] = weight
+	}
+
+	return criterion, weights
+}
+
+// OptionError is returned by the methods of Analytics when an option is
+// invalid, or unsupported by the method, telling it apart from the errors of
+// the Store.
+type OptionError struct {
+	Err error
+}
+
+func (e *OptionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+// parseListOptions returns the Analytics serving a single call: a copy of a
+// with options applied to fresh list options. a itself is left untouched, so
+// options neither leak into later calls nor race with concurrent ones.
+func (a *Analytics) parseListOptions(options []func(*Analytics) error) (*Analytics, error) {
+	call := &Analytics{store: a.store}
 	for _, option := range options {
-		err := option(a)
+		err := option(call)
 		if err != nil {
-			return err
+			return nil, &OptionError{Err: err}
 		}
 	}
 
-	return nil
+	return call, nil
+}
+
+// Stats is the breakdown of activity behind an entry's position in a ranking.
+type Stats struct {
+	Commits      int `json:"commits"`
+	Pushes       int `json:"pushes"`
+	PullRequests int `json:"pullRequests"`
+	Watches      int `json:"watches"`
+
+	// Total is the score the entry is ranked by. It counts the events
+	// matching the sort criterion, with CommitsPushed contributing the
+	// number of commits pushed rather than the number of pushes, each
+	// multiplied by the criteria's weight.
+	Total int `json:"total"`
+
+	// Error bounds the estimates of an approximate ranking, see
+	// Approximate. It is nil for exact rankings.
+	Error *StatsError `json:"error,omitempty"`
+}
+
+// UserResult is a user ranked by ListUsers along with its Stats.
+type UserResult struct {
+	Actor
+	Stats Stats `json:"stats"`
 }
 
-type EventsCountByUserID struct {
-	UserID      uint64
-	EventsCount int
+// RepoResult is a repository ranked by ListRepos along with its Stats.
+type RepoResult struct {
+	Repo
+	Stats Stats `json:"stats"`
 }
 
-func (a *Analytics) ListUsers(options ...func(*Analytics) error) ([]Actor, error) {
-	err := a.parseListOptions(options)
+// statsByID is the Stats of the user or repository identified by ID.
+type statsByID struct {
+	ID    uint64
+	Stats Stats
+
+	// criteria holds the unweighted value of each scoring criteria, in the
+	// order they were given to Sort, to break ties between equal Totals.
+	criteria []int
+}
+
+// rank computes the Stats of every user or repository, as identified by key,
+// having events matching the sort criterion. The result is unordered, see
+// paginate.
+func (a *Analytics) rank(ctx context.Context, key func(Event) uint64) ([]statsByID, error) {
+	criterion, weights := a.scoring()
+	if err := a.checkCriteria(ctx, criterion); err != nil {
+		return nil, err
+	}
+	filterEventTypes := a.buildList(criterion)
+
+	eventTypes := []EventType{PushEvent, PullRequestEvent, WatchEvent}
+	for _, evt := range filterEventTypes {
+		if evt != PushEvent && evt != PullRequestEvent && evt != WatchEvent {
+			eventTypes = append(eventTypes, evt)
+		}
+	}
+
+	// the page is checked before any event is scanned
+	counters := 0
+	if a.listOptions.approx {
+		if a.listOptions.bots != AllActors {
+			return nil, &OptionError{Err: errApproxBots}
+		}
+		var err error
+		if counters, err = a.approxCounters(); err != nil {
+			return nil, err
+		}
+	}
+
+	keep, err := a.botFilter(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	filterEventTypes := a.buildList(a.listOptions.sortCriterion)
+	if a.listOptions.approx {
+		score := func(evt Event, commitsCount int) (total int, matching bool) {
+			for i, c := range criterion {
+				if filterEventTypes[i] != evt.Type {
+					continue
+				}
+				matching = true
+				if c == CommitsPushed {
+					total += weights[i] * commitsCount
+				} else {
+					total += weights[i]
+				}
+			}
+			return total, matching
+		}
+		return a.rankApprox(ctx, key, a.eventFilter(eventTypes), counters, keep, score)
+	}
+
+	// A single pass over the events accumulates the Stats of each entry, so
+	// memory grows with the number of entries rather than events.
+	entries := make(map[uint64]*statsByID)
+	matching := make(map[uint64]bool)
+	err = a.store.ForEachEvent(ctx, a.eventFilter(eventTypes), func(evt Event, commitsCount int) error {
+		if keep != nil && !keep(evt.ActorID) {
+			return nil
+		}
+
+		id := key(evt)
+		r, ok := entries[id]
+		if !ok {
+			r = &statsByID{ID: id, criteria: make([]int, len(criterion))}
+			entries[id] = r
+		}
+
+		switch evt.Type {
+		case PushEvent:
+			r.Stats.Pushes++
+			r.Stats.Commits += commitsCount
+		case PullRequestEvent:
+			r.Stats.PullRequests++
+		case WatchEvent:
+			r.Stats.Watches++
+		}
 
-	events, err := a.store.GetEvents(func(e Event) bool {
-		for _, evt := range filterEventTypes {
-			if evt == e.Type {
-				return true
+		for i, c := range criterion {
+			if filterEventTypes[i] != evt.Type {
+				continue
+			}
+			matching[id] = true
+			if c == CommitsPushed {
+				r.criteria[i] += commitsCount
+			} else {
+				r.criteria[i]++
 			}
 		}
-		return false
+		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	eventsCollection := make([]Element, len(events))
-	for i, e := range events {
-		eventsCollection[i] = Element{Value: e}
+	ranking := make([]statsByID, 0, len(matching))
+	for id, r := range entries {
+		if !matching[id] {
+			continue
+		}
+		for i, v := range r.criteria {
+			r.Stats.Total += weights[i] * v
+		}
+		ranking = append(ranking, *r)
 	}
 
-	eventsByUserID := a.GroupBy(eventsCollection, func(el Element) interface{} {
-		evt, _ := el.Value.(Event)
-		return evt.ActorID
-	})
+	return ranking, nil
+}
 
-	// To store the keys in slice in sorted order
-	keys := make([]uint64, len(eventsByUserID))
-	i := 0
-	for k := range eventsByUserID {
-		userID, _ := k.(uint64)
-		keys[i] = userID
-		i++
+// rankingLess returns whether an entry ranks before another: by Total in
+// descending order, ties being broken by the value of each sort criteria in
+// the order they were given to Sort, then by the TieBreak key in ascending
+// order, and finally by ID so the order is always deterministic. name returns
+// the name of an entry for TieBreak ByName.
+func (a *Analytics) rankingLess(name func(id uint64) string) func(ri, rj statsByID) bool {
+	byName := a.listOptions.tieBreak == ByName
+
+	return func(ri, rj statsByID) bool {
+		if ri.Stats.Total != rj.Stats.Total {
+			return ri.Stats.Total > rj.Stats.Total
+		}
+		for k := range ri.criteria {
+			if ri.criteria[k] != rj.criteria[k] {
+				return ri.criteria[k] > rj.criteria[k]
+			}
+		}
+		if byName {
+			ni, nj := strings.ToLower(name(ri.ID)), strings.ToLower(name(rj.ID))
+			if ni != nj {
+				return ni < nj
+			}
+		}
+		return ri.ID < rj.ID
 	}
-	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+}
 
-	listOfEventsCountByUserID := make([]EventsCountByUserID, len(eventsByUserID))
-	idx := 0
-	for _, k := range keys {
-		v := eventsByUserID[k]
-		listOfEventsCountByUserID[idx] = EventsCountByUserID{
-			UserID:      k,
-			EventsCount: len(v),
-		}
-		idx++
+// paginate returns the page of ranking selected by the Offset and Limit
+// options, ordered by rankingLess. With a limit, only the entries up to the
+// end of the page are selected, through aggregate.TopK, rather than sorting
+// the whole ranking.
+func (a *Analytics) paginate(ranking []statsByID, name func(id uint64) string) []statsByID {
+	less := a.rankingLess(name)
+	if a.listOptions.limit > 0 {
+		_, end := a.page(len(ranking))
+		ranking = aggregate.TopK(ranking, end, less)
+	} else {
+		sort.Slice(ranking, func(i, j int) bool { return less(ranking[i], ranking[j]) })
 	}
 
-	sort.SliceStable(listOfEventsCountByUserID, func(i, j int) bool {
-		return listOfEventsCountByUserID[i].EventsCount > listOfEventsCountByUserID[j].EventsCount
-	})
+	start, end := a.page(len(ranking))
+	return ranking[start:end]
+}
 
-	users, err := a.store.GetUsers(func(a Actor) bool {
-		_, ok := eventsByUserID[a.ID]
-		return ok
-	})
+// page returns the bounds of the page selected by the Offset and Limit
+// options within n results. The limit is compared to the results left rather
+// than added to the offset, which would overflow for huge limits.
+func (a *Analytics) page(n int) (start, end int) {
+	start = a.listOptions.offset
+	if start > n {
+		start = n
+	}
+
+	end = n
+	if limit := a.listOptions.limit; limit > 0 && limit < end-start {
+		end = start + limit
+	}
+
+	return start, end
+}
+
+// ListUsers returns the users ranked by the sort criterion, along with the
+// Stats they were ranked by.
+func (a *Analytics) ListUsers(options ...func(*Analytics) error) ([]UserResult, error) {
+	return a.ListUsersContext(context.Background(), options...)
+}
+
+// ListUsersContext is like ListUsers, aborting with the context's error once
+// ctx is done.
+func (a *Analytics) ListUsersContext(ctx context.Context, options ...func(*Analytics) error) ([]UserResult, error) {
+	call, err := a.parseListOptions(options)
 	if err != nil {
 		return nil, err
 	}
 
-	var sortedUsers []Actor
-	for _, v := range listOfEventsCountByUserID {
+	ranking, err := call.rank(ctx, func(e Event) uint64 { return e.ActorID })
+	if err != nil {
+		return nil, err
+	}
+
+	usersByID := make(map[uint64]Actor)
+	lookup := func(ranking []statsByID) error {
+		// IDs are unique within a ranking
+		ids := make([]uint64, len(ranking))
+		for i, r := range ranking {
+			ids[i] = r.ID
+		}
+
+		users, err := call.store.GetUsersByIDs(ctx, ids)
+		if err != nil {
+			return err
+		}
+
 		for _, u := range users {
-			if v.UserID == u.ID {
-				sortedUsers = append(sortedUsers, u)
-			}
+			usersByID[u.ID] = u
+		}
+		return nil
+	}
+
+	// Breaking ties by name needs every ranked entry looked up, otherwise
+	// only the returned page is.
+	byName := call.listOptions.tieBreak == ByName
+	if byName {
+		if err := lookup(ranking); err != nil {
+			return nil, err
+		}
+	}
+
+	ranking = call.paginate(ranking, func(id uint64) string { return usersByID[id].Username })
+
+	if !byName {
+		if err := lookup(ranking); err != nil {
+			return nil, err
+		}
+	}
+
+	topNUsers := make([]UserResult, len(ranking))
+	for i, r := range ranking {
+		u, ok := usersByID[r.ID]
+		if !ok {
+			// the user is missing from the store, keep what the events tell
+			u = Actor{ID: r.ID}
 		}
+		topNUsers[i] = UserResult{Actor: u, Stats: r.Stats}
 	}
 
-	topNUsers := sortedUsers[0:a.listOptions.limit]
 	return topNUsers, nil
 }
 
-type EventsCountByRepoID struct {
-	RepoID      uint64
-	EventsCount int
+// ListRepos returns the repositories ranked by the sort criterion, along with
+// the Stats they were ranked by.
+func (a *Analytics) ListRepos(options ...func(*Analytics) error) ([]RepoResult, error) {
+	return a.ListReposContext(context.Background(), options...)
 }
 
-func (a *Analytics) ListRepos(options ...func(*Analytics) error) ([]Repo, error) {
-	err := a.parseListOptions(options)
+// ListReposContext is like ListRepos, aborting with the context's error once
+// ctx is done.
+func (a *Analytics) ListReposContext(ctx context.Context, options ...func(*Analytics) error) ([]RepoResult, error) {
+	call, err := a.parseListOptions(options)
 	if err != nil {
 		return nil, err
 	}
 
-	filterEventTypes := a.buildList(a.listOptions.sortCriterion)
-	events, err := a.store.GetEvents(func(e Event) bool {
-		for _, evt := range filterEventTypes {
-			if evt == e.Type {
-				return true
-			}
-		}
-		return false
-	})
+	ranking, err := call.rank(ctx, func(e Event) uint64 { return e.RepoID })
 	if err != nil {
 		return nil, err
 	}
 
-	eventsCollection := make([]Element, len(events))
-	for i, e := range events {
-		eventsCollection[i] = Element{Value: e}
-	}
+	reposByID := make(map[uint64]Repo)
+	lookup := func(ranking []statsByID) error {
+		// IDs are unique within a ranking
+		ids := make([]uint64, len(ranking))
+		for i, r := range ranking {
+			ids[i] = r.ID
+		}
 
-	eventsByRepoID := a.GroupBy(eventsCollection, func(el Element) interface{} {
-		evt, _ := el.Value.(Event)
-		return evt.RepoID
-	})
+		repos, err := call.store.GetReposByIDs(ctx, ids)
+		if err != nil {
+			return err
+		}
 
-	// To store the keys in slice in sorted order
-	keys := make([]uint64, len(eventsByRepoID))
-	i := 0
-	for k := range eventsByRepoID {
-		userID, _ := k.(uint64)
-		keys[i] = userID
-		i++
+		for _, r := range repos {
+			reposByID[r.ID] = r
+		}
+		return nil
 	}
-	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
 
-	listOfEventsCountByRepoID := make([]EventsCountByRepoID, len(eventsByRepoID))
-	idx := 0
-	for _, k := range keys {
-		v := eventsByRepoID[k]
-		listOfEventsCountByRepoID[idx] = EventsCountByRepoID{
-			RepoID:      k,
-			EventsCount: len(v),
+	// Breaking ties by name needs every ranked entry looked up, otherwise
+	// only the returned page is.
+	byName := call.listOptions.tieBreak == ByName
+	if byName {
+		if err := lookup(ranking); err != nil {
+			return nil, err
 		}
-		idx++
 	}
 
-	sort.SliceStable(listOfEventsCountByRepoID, func(i, j int) bool {
-		return listOfEventsCountByRepoID[i].EventsCount > listOfEventsCountByRepoID[j].EventsCount
-	})
+	ranking = call.paginate(ranking, func(id uint64) string { return reposByID[id].Name })
 
-	repos, err := a.store.GetRepos(func(r Repo) bool {
-		_, ok := eventsByRepoID[r.ID]
-		return ok
-	})
-	if err != nil {
-		return nil, err
+	if !byName {
+		if err := lookup(ranking); err != nil {
+			return nil, err
+		}
 	}
 
-	var sortedRepos []Repo
-	for _, v := range listOfEventsCountByRepoID {
-		for _, r := range repos {
-			if v.RepoID == r.ID {
-				sortedRepos = append(sortedRepos, r)
-			}
+	topNRepos := make([]RepoResult, len(ranking))
+	for i, r := range ranking {
+		repo, ok := reposByID[r.ID]
+		if !ok {
+			// the repository is missing from the store, keep what the
+			// events tell
+			repo = Repo{ID: r.ID}
 		}
+		topNRepos[i] = RepoResult{Repo: repo, Stats: r.Stats}
 	}
 
-	topNRepos := sortedRepos[0:a.listOptions.limit]
 	return topNRepos, nil
 }
 
+// Element wraps a value grouped by GroupBy.
+//
+// Deprecated: use the aggregate package, whose helpers are type-safe.
 type Element struct {
 	Value interface{}
 }
 
+// GroupBy returns the elements grouped by the key of each.
+//
+// Deprecated: use aggregate.GroupBy, which needs no type assertions.
 func (a Analytics) GroupBy(ls []Element, keyGetter func(item Element) interface{}) map[interface{}][]Element {
-	grouped := make(map[interface{}][]Element)
-
-	for _, el := range ls {
-		key := keyGetter(el)
-
-		_, ok := grouped[key]
-		if !ok {
-			grouped[key] = []Element{}
-			grouped[key] = append(grouped[key], el)
-		} else {
-			grouped[key] = append(grouped[key], el)
-		}
-	}
-
-	return grouped
+	return aggregate.GroupBy(ls, keyGetter)
 }
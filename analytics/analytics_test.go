@@ -1,34 +1,30 @@
 package analytics_test
 
 import (
+	"errors"
 	"io"
+	"math"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/dikaeinstein/ghanalytics/analytics"
 	"github.com/dikaeinstein/ghanalytics/data"
 )
 
 func TestListTopNUsers(t *testing.T) {
-	expectedActors := []analytics.Actor{
-		{8517910, "LombiqBot"},
-		{29139614, "renovate[bot]"},
-		{44826218, "MatoPlus"},
-		{625469, "armano2"},
-		{1008205, "wigforss"},
-		{2134633, "buddyspike"},
-		{2631623, "onosendi"},
-		{2895902, "patsonluk"},
-		{5271692, "romankagan"},
-		{5954907, "awesomekling"},
-		{2631623, "onosendi"},
-		{24802628, "gpeterson406"},
-		{37038626, "geos4s"},
-		{46163555, "PySimpleGUI"},
-		{2895902, "patsonluk"},
-		{30060991, "m41na"},
-		{43908490, "jick155"},
+	expectedUsers := []analytics.UserResult{
+		{Actor: analytics.Actor{ID: 29139614, Username: "renovate[bot]"}, Stats: analytics.Stats{Commits: 7, Pushes: 2, Total: 7}},
+		{Actor: analytics.Actor{ID: 8422699, Username: "Apexal"}, Stats: analytics.Stats{Commits: 4, Pushes: 1, Total: 4}},
+		{Actor: analytics.Actor{ID: 24802628, Username: "gpeterson406"}, Stats: analytics.Stats{Commits: 4, Pushes: 1, Total: 4}},
+		{Actor: analytics.Actor{ID: 30060991, Username: "m41na"}, Stats: analytics.Stats{Commits: 2, Pushes: 1, Total: 2}},
+		{Actor: analytics.Actor{ID: 44826218, Username: "MatoPlus"}, Stats: analytics.Stats{Commits: 2, Pushes: 2, Total: 2}},
+		{Actor: analytics.Actor{ID: 2134633, Username: "buddyspike"}, Stats: analytics.Stats{Commits: 1, Pushes: 1, Total: 1}},
+		{Actor: analytics.Actor{ID: 2631623, Username: "onosendi"}, Stats: analytics.Stats{Commits: 1, Pushes: 1, Total: 1}},
+		{Actor: analytics.Actor{ID: 2895902, Username: "patsonluk"}, Stats: analytics.Stats{Commits: 1, Pushes: 1, Total: 1}},
+		{Actor: analytics.Actor{ID: 5954907, Username: "awesomekling"}, Stats: analytics.Stats{Commits: 1, Pushes: 1, Total: 1}},
+		{Actor: analytics.Actor{ID: 13025337, Username: "bitnami-bot"}, Stats: analytics.Stats{Commits: 1, Pushes: 1, Total: 1}},
 	}
 
 	testCases := []struct {
@@ -72,27 +68,27 @@ func TestListTopNUsers(t *testing.T) {
 					tC.limit, len(topNUsers))
 			}
 
-			expectedNActors := expectedActors[0:tC.limit]
-			if !reflect.DeepEqual(topNUsers, expectedNActors) {
+			expectedNUsers := expectedUsers[0:tC.limit]
+			if !reflect.DeepEqual(topNUsers, expectedNUsers) {
 				t.Errorf("Wrong topNUsers returned. want %+v; got %+v",
-					expectedNActors, topNUsers)
+					expectedNUsers, topNUsers)
 			}
 		})
 	}
 }
 
 func TestListTopNRepos(t *testing.T) {
-	expectedRepos := []analytics.Repo{
-		{ID: 42018768, Name: "Lombiq/Helpful-Libraries"},
-		{ID: 62069489, Name: "multicharts/scanner-check"},
-		{ID: 204268723, Name: "supershell2019/conf"},
-		{ID: 231160326, Name: "MatoPlus/react-jsx-lab-cb-gh-000"},
-		{ID: 6495132, Name: "wikimedia/mediawiki-extensions-CentralAuth"},
-		{ID: 20598648, Name: "ElvUI-WotLK/ElvUI"},
-		{ID: 45993266, Name: "patsonluk/airline"},
-		{ID: 53678002, Name: "qiyanjun/books2read"},
-		{ID: 67651864, Name: "Lombiq/Git-Hg-Mirror-Common"},
-		{ID: 83585690, Name: "TedTschopp/tschopp.net"},
+	expectedRepos := []analytics.RepoResult{
+		{Repo: analytics.Repo{ID: 230275330, Name: "mrlynn/mongodb-github-student"}, Stats: analytics.Stats{Commits: 5, Pushes: 1, Total: 5}},
+		{Repo: analytics.Repo{ID: 100496729, Name: "gpeterson406/Greenwood_Book"}, Stats: analytics.Stats{Commits: 4, Pushes: 1, Total: 4}},
+		{Repo: analytics.Repo{ID: 224252202, Name: "DSC-RPI/dsc-portal"}, Stats: analytics.Stats{Commits: 4, Pushes: 1, Total: 4}},
+		{Repo: analytics.Repo{ID: 83585690, Name: "TedTschopp/tschopp.net"}, Stats: analytics.Stats{Commits: 2, Pushes: 1, Total: 2}},
+		{Repo: analytics.Repo{ID: 230923653, Name: "m41na/demo-micro-services"}, Stats: analytics.Stats{Commits: 2, Pushes: 1, Total: 2}},
+		{Repo: analytics.Repo{ID: 231160326, Name: "MatoPlus/react-jsx-lab-cb-gh-000"}, Stats: analytics.Stats{Commits: 2, Pushes: 2, Total: 2}},
+		{Repo: analytics.Repo{ID: 45993266, Name: "patsonluk/airline"}, Stats: analytics.Stats{Commits: 1, Pushes: 1, Total: 1}},
+		{Repo: analytics.Repo{ID: 140614233, Name: "PySimpleGUI/PySimpleGUI"}, Stats: analytics.Stats{Commits: 1, Pushes: 1, Total: 1}},
+		{Repo: analytics.Repo{ID: 155254893, Name: "onosendi/flask-dlindegren"}, Stats: analytics.Stats{Commits: 1, Pushes: 1, Total: 1}},
+		{Repo: analytics.Repo{ID: 159298221, Name: "geos4s/18w856162"}, Stats: analytics.Stats{Commits: 1, Pushes: 1, Total: 1}},
 	}
 
 	testCases := []struct {
@@ -143,6 +139,372 @@ func TestListTopNRepos(t *testing.T) {
 	}
 }
 
+func TestListTieBreaking(t *testing.T) {
+	store, err := data.NewStore(
+		strings.NewReader("id,username\n1,zoe\n2,Bob\n3,alice\n4,carol\n4,carol"),
+		strings.NewReader("sha,message,event_id\na,first,10\nb,second,11"),
+		strings.NewReader(`id,type,actor_id,repo_id
+10,PushEvent,1,100
+11,PushEvent,2,100
+12,PullRequestEvent,3,100
+13,PullRequestEvent,3,100
+14,PushEvent,4,100
+15,PullRequestEvent,4,100`),
+		strings.NewReader("id,name\n100,team/repo"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc          string
+		sortCriterion []analytics.SortCriteria
+		tieBreak      analytics.TieBreaker
+		expected      []string
+	}{
+		{
+			desc:          "Secondary criteria, then ID",
+			sortCriterion: []analytics.SortCriteria{analytics.CommitsPushed, analytics.PrCreated},
+			tieBreak:      analytics.ByID,
+			expected:      []string{"alice", "zoe", "Bob", "carol"},
+		},
+		{
+			desc:          "Secondary criteria in the given order",
+			sortCriterion: []analytics.SortCriteria{analytics.PrCreated, analytics.CommitsPushed},
+			tieBreak:      analytics.ByID,
+			expected:      []string{"alice", "carol", "zoe", "Bob"},
+		},
+		{
+			desc:          "Secondary criteria, then name",
+			sortCriterion: []analytics.SortCriteria{analytics.CommitsPushed, analytics.PrCreated},
+			tieBreak:      analytics.ByName,
+			expected:      []string{"alice", "Bob", "zoe", "carol"},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			users, err := analytics.New(store).ListUsers(
+				analytics.Sort(tC.sortCriterion),
+				analytics.TieBreak(tC.tieBreak),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			names := make([]string, len(users))
+			for i, u := range users {
+				names[i] = u.Username
+			}
+			if !reflect.DeepEqual(names, tC.expected) {
+				t.Errorf("Wrong order returned. want %v; got %v", tC.expected, names)
+			}
+		})
+	}
+
+	if _, err := analytics.New(store).ListUsers(analytics.TieBreak("age")); err == nil {
+		t.Error("expected error for unknown tie break; got nil")
+	}
+}
+
+func TestListWeighted(t *testing.T) {
+	store, err := data.NewStore(
+		strings.NewReader("id,username\n1,alice\n2,bob\n3,carol"),
+		strings.NewReader("sha,message,event_id\na,first,10\nb,second,10"),
+		strings.NewReader(`id,type,actor_id,repo_id
+10,PushEvent,1,100
+11,PullRequestEvent,2,100
+12,PullRequestReviewCommentEvent,3,100
+13,PullRequestReviewCommentEvent,3,100
+14,PushEvent,3,100`),
+		strings.NewReader("id,name\n100,team/repo"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc          string
+		sortCriterion []analytics.SortCriteria
+		weights       map[analytics.SortCriteria]int
+		expected      []string
+		totals        []int
+	}{
+		{
+			desc: "Weighted criteria only",
+			weights: map[analytics.SortCriteria]int{
+				analytics.PrCreated:      5,
+				analytics.Pushes:         1,
+				analytics.ReviewComments: 2,
+			},
+			expected: []string{"carol", "bob", "alice"},
+			totals:   []int{5, 5, 1},
+		},
+		{
+			desc:          "Sort criteria default to weight 1",
+			sortCriterion: []analytics.SortCriteria{analytics.CommitsPushed},
+			weights:       map[analytics.SortCriteria]int{analytics.PrCreated: 3},
+			expected:      []string{"bob", "alice", "carol"},
+			totals:        []int{3, 2, 0},
+		},
+		{
+			desc:          "Zero weight keeps criteria for ties only",
+			sortCriterion: []analytics.SortCriteria{analytics.ReviewComments, analytics.CommitsPushed},
+			weights:       map[analytics.SortCriteria]int{analytics.ReviewComments: 0},
+			expected:      []string{"alice", "carol"},
+			totals:        []int{2, 0},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			users, err := analytics.New(store).ListUsers(
+				analytics.Sort(tC.sortCriterion),
+				analytics.Weights(tC.weights),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			names := make([]string, len(users))
+			totals := make([]int, len(users))
+			for i, u := range users {
+				names[i] = u.Username
+				totals[i] = u.Stats.Total
+			}
+			if !reflect.DeepEqual(names, tC.expected) {
+				t.Errorf("Wrong order returned. want %v; got %v", tC.expected, names)
+			}
+			if !reflect.DeepEqual(totals, tC.totals) {
+				t.Errorf("Wrong totals returned. want %v; got %v", tC.totals, totals)
+			}
+		})
+	}
+
+	_, err = analytics.New(store).ListUsers(
+		analytics.Weights(map[analytics.SortCriteria]int{analytics.PrCreated: -1}),
+	)
+	if err == nil {
+		t.Error("expected error for negative weight; got nil")
+	}
+}
+
+func TestListByEventType(t *testing.T) {
+	store, err := data.NewStore(
+		strings.NewReader("id,username\n1,alice\n2,bob"),
+		strings.NewReader("sha,message,event_id"),
+		strings.NewReader(`id,type,actor_id,repo_id
+10,ForkEvent,1,100
+11,ForkEvent,2,200
+12,ForkEvent,1,200
+13,IssueCommentEvent,2,100
+14,DiscussionEvent,1,100`),
+		strings.NewReader("id,name\n100,team/one\n200,team/two"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repos, err := analytics.New(store).ListRepos(
+		analytics.Sort([]analytics.SortCriteria{analytics.Forks}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedRepos := []analytics.RepoResult{
+		{Repo: analytics.Repo{ID: 200, Name: "team/two"}, Stats: analytics.Stats{Total: 2}},
+		{Repo: analytics.Repo{ID: 100, Name: "team/one"}, Stats: analytics.Stats{Total: 1}},
+	}
+	if !reflect.DeepEqual(repos, expectedRepos) {
+		t.Errorf("Wrong repos returned. want %+v; got %+v", expectedRepos, repos)
+	}
+
+	users, err := analytics.New(store).ListUsers(
+		analytics.Sort([]analytics.SortCriteria{analytics.IssueComments}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Username != "bob" {
+		t.Errorf("Wrong users returned. want [bob]; got %+v", users)
+	}
+
+	// event types without a constant are criteria all the same
+	users, err = analytics.New(store).ListUsers(
+		analytics.Weights(map[analytics.SortCriteria]int{"DiscussionEvent": 3}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Username != "alice" || users[0].Stats.Total != 3 {
+		t.Errorf("Wrong users returned. want [alice] with a total of 3; got %+v", users)
+	}
+}
+
+func TestListUnknownCriteria(t *testing.T) {
+	store := createStore(t)
+
+	_, err := analytics.New(store).ListUsers(
+		analytics.Sort([]analytics.SortCriteria{analytics.CommitsPushed, "stars"}),
+	)
+	var optionErr *analytics.OptionError
+	if !errors.As(err, &optionErr) {
+		t.Errorf("expected OptionError for unknown sort criteria; got %v", err)
+	}
+
+	_, err = analytics.New(store).ListRepos(
+		analytics.Weights(map[analytics.SortCriteria]int{"stars": 2}),
+	)
+	if err == nil {
+		t.Error("expected error for unknown weight criteria; got nil")
+	}
+
+	// a well formed name is rejected unless the store holds such events
+	_, err = analytics.New(store).ListUsers(
+		analytics.Sort([]analytics.SortCriteria{"PullRequestsEvent"}),
+	)
+	if !errors.As(err, &optionErr) {
+		t.Errorf("expected OptionError for unknown event type; got %v", err)
+	}
+}
+
+func TestListUsersUnique(t *testing.T) {
+	users, err := analytics.New(createStore(t)).ListUsers(
+		analytics.Sort([]analytics.SortCriteria{
+			analytics.CommitsPushed, analytics.PrCreated,
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[uint64]bool)
+	for _, u := range users {
+		if seen[u.ID] {
+			t.Errorf("User %+v listed more than once", u.Actor)
+		}
+		seen[u.ID] = true
+	}
+}
+
+func TestListUsersPagination(t *testing.T) {
+	store := createStore(t)
+	sortCriterion := analytics.Sort([]analytics.SortCriteria{
+		analytics.CommitsPushed, analytics.PrCreated,
+	})
+
+	all, err := analytics.New(store).ListUsers(sortCriterion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 48 {
+		t.Fatalf("Length of unlimited ranking does not match. want 48; got %d", len(all))
+	}
+
+	testCases := []struct {
+		desc     string
+		limit    int
+		offset   int
+		expected []analytics.UserResult
+	}{
+		{desc: "Zero limit is unlimited", expected: all},
+		{desc: "Limit above available results", limit: 100, expected: all},
+		{desc: "First page", limit: 15, expected: all[0:15]},
+		{desc: "Middle page", limit: 15, offset: 15, expected: all[15:30]},
+		{desc: "Single entry", limit: 1, offset: 7, expected: all[7:8]},
+		{desc: "Last partial page", limit: 15, offset: 45, expected: all[45:]},
+		{desc: "Offset past the end", limit: 15, offset: 60, expected: []analytics.UserResult{}},
+		{desc: "Largest limit", limit: math.MaxInt, offset: 1, expected: all[1:]},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			users, err := analytics.New(store).ListUsers(
+				sortCriterion,
+				analytics.Limit(tC.limit),
+				analytics.Offset(tC.offset),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(users, tC.expected) {
+				t.Errorf("Wrong page returned. want %+v; got %+v", tC.expected, users)
+			}
+		})
+	}
+}
+
+func TestListInvalidPagination(t *testing.T) {
+	a := analytics.New(createStore(t))
+
+	if _, err := a.ListUsers(analytics.Limit(-1)); err == nil {
+		t.Error("expected error for negative limit; got nil")
+	}
+	if _, err := a.ListRepos(analytics.Offset(-1)); err == nil {
+		t.Error("expected error for negative offset; got nil")
+	}
+}
+
+func TestListReposWindow(t *testing.T) {
+	store, err := data.NewStore(
+		strings.NewReader("id,username\n1,alice\n2,bob"),
+		strings.NewReader("sha,message,event_id"),
+		strings.NewReader(`id,type,actor_id,repo_id,created_at
+1,WatchEvent,1,10,2020-01-01T15:00:00Z
+2,WatchEvent,2,10,2020-01-01T15:30:00Z
+3,WatchEvent,1,20,2020-01-01T16:00:00Z
+4,WatchEvent,2,20,2020-01-01T16:10:00Z
+5,WatchEvent,1,20,2020-01-01T16:20:00Z
+6,WatchEvent,2,30,`),
+		strings.NewReader("id,name\n10,alice/ten\n20,bob/twenty\n30,bob/thirty"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(hour, min int) time.Time {
+		return time.Date(2020, 1, 1, hour, min, 0, 0, time.UTC)
+	}
+
+	testCases := []struct {
+		desc     string
+		since    time.Time
+		until    time.Time
+		expected []uint64
+	}{
+		{desc: "No window", expected: []uint64{20, 10, 30}},
+		{desc: "Since", since: at(16, 0), expected: []uint64{20}},
+		{desc: "Until", until: at(16, 0), expected: []uint64{10}},
+		{desc: "Since and Until", since: at(15, 30), until: at(16, 15), expected: []uint64{20, 10}},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			a := analytics.New(store)
+			repos, err := a.ListRepos(
+				analytics.Sort([]analytics.SortCriteria{
+					analytics.Watches,
+				}),
+				analytics.Since(tC.since),
+				analytics.Until(tC.until),
+				analytics.Limit(len(tC.expected)),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := make([]uint64, len(repos))
+			for i, r := range repos {
+				ids[i] = r.ID
+			}
+			if !reflect.DeepEqual(ids, tC.expected) {
+				t.Errorf("Wrong repos returned. want %v; got %v", tC.expected, ids)
+			}
+		})
+	}
+}
+
 func createStore(t *testing.T) *data.Store {
 	t.Helper()
 
@@ -0,0 +1,253 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/dikaeinstein/ghanalytics/sketch"
+)
+
+// Sizes of the sketches of approximate mode, keeping its memory fixed.
+const (
+	// approxCounters is the least number of entries an approximate ranking
+	// tracks, approxOversample times the entries up to the end of the page
+	// requested being tracked when more, up to maxApproxCounters. Pages
+	// ending past maxApproxCounters/approxOversample entries are rejected.
+	approxCounters    = 4096
+	approxOversample  = 4
+	maxApproxCounters = 65536
+
+	// approxEpsilon and approxDelta size the Count-Min sketches of the
+	// Stats breakdown: an estimate exceeds the exact count by at most
+	// approxEpsilon times the count of all entries combined, with
+	// probability 1-approxDelta.
+	approxEpsilon = 0.001
+	approxDelta   = 0.01
+
+	// approxPrecision sizes the HyperLogLog counting distinct actors and
+	// repositories, to 2^approxPrecision registers and a standard error of
+	// 0.8%.
+	approxPrecision = 14
+
+	// approxConfidence is the number of standard errors the distinct
+	// counts are bounded by, for 95% confidence.
+	approxConfidence = 1.96
+
+	// summaryCounters is the number of actors Summary tracks to estimate
+	// the share of the most active ones.
+	summaryCounters = 16384
+)
+
+// errApproxOwners is returned by ListOwners in approximate mode, the
+// repositories of an owner being unknown until the end of the scan.
+var errApproxOwners = errors.New("approximate mode is not supported by ListOwners")
+
+// errApproxBots is returned by the approximate rankings filtering bots, whose
+// detection keeps the pushes and commit messages of every actor in memory.
+var errApproxBots = errors.New("approximate mode cannot filter bots")
+
+// StatsError bounds how much the Stats of an approximate ranking overestimate
+// the exact ones. Total is always within its bound, found by the Space-Saving
+// algorithm, while the breakdown, estimated by Count-Min sketches, is within
+// its bound with 99% probability.
+type StatsError struct {
+	Commits      int `json:"commits"`
+	Pushes       int `json:"pushes"`
+	PullRequests int `json:"pullRequests"`
+	Watches      int `json:"watches"`
+	Total        int `json:"total"`
+}
+
+// SummaryError bounds the estimates of an approximate Summary: Actors, Repos
+// and TopUsersShare are within their bound of the exact values with 95%
+// confidence.
+type SummaryError struct {
+	Actors        int     `json:"actors"`
+	Repos         int     `json:"repos"`
+	TopUsersShare float64 `json:"topUsersShare"`
+}
+
+// Approximate estimates the rankings of ListUsers and ListRepos, and the
+// distinct actors, repositories and top users share of Summary, with fixed
+// size sketches rather than exact counters, so memory stays the same however
+// many events are scanned. Results report the bounds of their error.
+//
+// Approximate rankings hold the few thousand entries scoring the most at
+// most, ordered by Total then by the TieBreak key, and a page given by Offset
+// and Limit must end within the first 16384 entries. Detecting bots keeps the
+// pushes and commit messages of every actor in memory, so the rankings reject
+// the option along with a Bots filter. ListOwners rejects the option and the
+// other methods ignore it.
+func Approximate(on bool) func(*Analytics) error {
+	return func(a *Analytics) error {
+		return a.setListOptionsApprox(on)
+	}
+}
+
+func (a *Analytics) setListOptionsApprox(on bool) error {
+	a.listOptions.approx = on
+	return nil
+}
+
+// approxCounters returns the number of entries an approximate ranking tracks
+// to serve the page selected by the Offset and Limit options, or an error
+// when the page ends past the entries it may track.
+func (a *Analytics) approxCounters() (int, error) {
+	limit := a.listOptions.limit
+	if limit == 0 {
+		return approxCounters, nil
+	}
+
+	// compared rather than summed, which would overflow for huge pages
+	maxEnd := maxApproxCounters / approxOversample
+	if offset := a.listOptions.offset; offset > maxEnd || limit > maxEnd-offset {
+		return 0, &OptionError{Err: fmt.Errorf(
+			"invalid page: approximate rankings end at entry %d, use a lower offset or limit", maxEnd)}
+	}
+
+	counters := approxOversample * (a.listOptions.offset + limit)
+	if counters < approxCounters {
+		counters = approxCounters
+	}
+	return counters, nil
+}
+
+// rankApprox estimates the Stats of the users or repositories, as identified
+// by key, scoring the most, tracking the given number of counters. score
+// returns the amount an event adds to the Total of its entry, and whether it
+// matches the sort criterion at all. keep, when set, tells whether the events
+// of an actor are ranked.
+func (a *Analytics) rankApprox(ctx context.Context, key func(Event) uint64, filter EventFilter, counters int,
+	keep func(uint64) bool, score func(Event, int) (int, bool)) ([]statsByID, error) {
+	totals, err := sketch.NewSpaceSaving(counters)
+	if err != nil {
+		return nil, err
+	}
+	commits := sketch.NewCountMin(approxEpsilon, approxDelta)
+	pushes := sketch.NewCountMin(approxEpsilon, approxDelta)
+	pullRequests := sketch.NewCountMin(approxEpsilon, approxDelta)
+	watches := sketch.NewCountMin(approxEpsilon, approxDelta)
+
+	err = a.store.ForEachEvent(ctx, filter, func(evt Event, commitsCount int) error {
+		if keep != nil && !keep(evt.ActorID) {
+			return nil
+		}
+
+		id := key(evt)
+		switch evt.Type {
+		case PushEvent:
+			pushes.Add(id, 1)
+			commits.Add(id, uint64(commitsCount))
+		case PullRequestEvent:
+			pullRequests.Add(id, 1)
+		case WatchEvent:
+			watches.Add(id, 1)
+		}
+
+		if total, matching := score(evt, commitsCount); matching {
+			totals.Add(id, uint64(total))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	statsError := StatsError{
+		Commits:      int(commits.ErrorBound()),
+		Pushes:       int(pushes.ErrorBound()),
+		PullRequests: int(pullRequests.ErrorBound()),
+		Watches:      int(watches.ErrorBound()),
+	}
+
+	var ranking []statsByID
+	for _, c := range totals.Counters() {
+		e := statsError
+		e.Total = int(c.Error)
+		ranking = append(ranking, statsByID{
+			ID: c.Key,
+			Stats: Stats{
+				Commits:      int(commits.Count(c.Key)),
+				Pushes:       int(pushes.Count(c.Key)),
+				PullRequests: int(pullRequests.Count(c.Key)),
+				Watches:      int(watches.Count(c.Key)),
+				Total:        int(c.Count),
+				Error:        &e,
+			},
+		})
+	}
+
+	return ranking, nil
+}
+
+// approxSummary estimates the distinct actors and repositories of a
+// Summary, and the share of its most active users.
+type approxSummary struct {
+	actors    *sketch.HyperLogLog
+	repos     *sketch.HyperLogLog
+	topActors *sketch.SpaceSaving
+}
+
+func newApproxSummary() *approxSummary {
+	// summaryCounters is a valid capacity
+	topActors, _ := sketch.NewSpaceSaving(summaryCounters)
+	return &approxSummary{
+		actors:    sketch.NewHyperLogLog(approxPrecision),
+		repos:     sketch.NewHyperLogLog(approxPrecision),
+		topActors: topActors,
+	}
+}
+
+func (s *approxSummary) add(e Event) {
+	s.actors.Add(e.ActorID)
+	s.repos.Add(e.RepoID)
+	s.topActors.Add(e.ActorID, 1)
+}
+
+// fill sets the estimates of summary, whose TotalEvents is counted, along
+// with their error.
+func (s *approxSummary) fill(summary *Summary) {
+	summary.Actors = int(s.actors.Count())
+	summary.Repos = int(s.repos.Count())
+	summary.Error = &SummaryError{
+		Actors: int(math.Ceil(approxConfidence * s.actors.StdError() * float64(summary.Actors))),
+		Repos:  int(math.Ceil(approxConfidence * s.repos.StdError() * float64(summary.Repos))),
+	}
+	if summary.TotalEvents == 0 {
+		return
+	}
+
+	// The estimated amounts of the k top counters add up to at least the
+	// events of the k most active users, and at most their errors more.
+	// As k follows from the estimated actors, the exact share lies between
+	// the lowest and highest k the bound of the actors allows.
+	counters := s.topActors.Counters()
+	prefix := func(k int) (events, overcount uint64) {
+		for i := 0; i < k && i < len(counters); i++ {
+			events += counters[i].Count
+			overcount += counters[i].Error
+		}
+		return events, overcount
+	}
+	share := func(events uint64) float64 {
+		return float64(events) / float64(summary.TotalEvents)
+	}
+	top := func(actors int) int {
+		if actors < 1 {
+			actors = 1
+		}
+		return (actors*topUsersPercent + 99) / 100
+	}
+
+	events, _ := prefix(top(summary.Actors))
+	lowEvents, lowOvercount := prefix(top(summary.Actors - summary.Error.Actors))
+	highEvents, _ := prefix(top(summary.Actors + summary.Error.Actors))
+
+	summary.TopUsersShare = share(events)
+	summary.Error.TopUsersShare = math.Max(
+		share(highEvents)-summary.TopUsersShare,
+		summary.TopUsersShare-share(lowEvents-lowOvercount),
+	)
+}
@@ -0,0 +1,155 @@
+package analytics_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+)
+
+func TestListApproximate(t *testing.T) {
+	an := analytics.New(createStore(t))
+	sortCriterion := analytics.Sort([]analytics.SortCriteria{
+		analytics.CommitsPushed, analytics.PrCreated,
+	})
+
+	exact, err := an.ListUsers(sortCriterion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exactByID := make(map[uint64]analytics.Stats, len(exact))
+	for _, u := range exact {
+		exactByID[u.ID] = u.Stats
+	}
+
+	approx, err := an.ListUsers(sortCriterion, analytics.Limit(10), analytics.Approximate(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(approx) != 10 {
+		t.Fatalf("Wrong number of users returned. want 10; got %d", len(approx))
+	}
+
+	for i, u := range approx {
+		if u.Stats.Error == nil {
+			t.Fatalf("Missing error bounds for %+v", u)
+		}
+		want, got := exactByID[u.ID], u.Stats
+
+		// fewer users than counters are tracked exactly
+		if got.Total != want.Total || got.Error.Total != 0 {
+			t.Errorf("Wrong total returned for %s. want %d; got %d (error %d)",
+				u.Username, want.Total, got.Total, got.Error.Total)
+		}
+		if got.Total != exact[i].Stats.Total {
+			t.Errorf("Wrong total returned at position %d. want %d; got %d", i, exact[i].Stats.Total, got.Total)
+		}
+
+		bounds := []struct {
+			name             string
+			got, want, bound int
+		}{
+			{"commits", got.Commits, want.Commits, got.Error.Commits},
+			{"pushes", got.Pushes, want.Pushes, got.Error.Pushes},
+			{"pull requests", got.PullRequests, want.PullRequests, got.Error.PullRequests},
+			{"watches", got.Watches, want.Watches, got.Error.Watches},
+		}
+		for _, b := range bounds {
+			if b.got < b.want || b.got-b.want > b.bound {
+				t.Errorf("Estimated %s of %s out of bounds. want %d (+%d); got %d",
+					b.name, u.Username, b.want, b.bound, b.got)
+			}
+		}
+	}
+}
+
+func TestListApproximatePage(t *testing.T) {
+	an := analytics.New(createStore(t))
+
+	testCases := []struct {
+		desc   string
+		limit  int
+		offset int
+		valid  bool
+	}{
+		{desc: "Unlimited", valid: true},
+		{desc: "Last tracked entry", limit: 16383, offset: 1, valid: true},
+		{desc: "Past the tracked entries", limit: 16384, offset: 1},
+		{desc: "Largest limit", limit: math.MaxInt, offset: 1},
+		{desc: "Largest offset", limit: 1, offset: math.MaxInt},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			_, err := an.ListRepos(analytics.Approximate(true),
+				analytics.Limit(tC.limit), analytics.Offset(tC.offset))
+
+			var optionErr *analytics.OptionError
+			if tC.valid && err != nil {
+				t.Errorf("err got %v, want nil", err)
+			}
+			if !tC.valid && !errors.As(err, &optionErr) {
+				t.Errorf("err got %v, want OptionError", err)
+			}
+		})
+	}
+}
+
+func TestSummaryApproximate(t *testing.T) {
+	an := analytics.New(createStore(t))
+
+	exact, err := an.Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	approx, err := an.Summary(analytics.Approximate(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if approx.Error == nil {
+		t.Fatal("Missing error bounds")
+	}
+	if approx.TotalEvents != exact.TotalEvents || approx.Commits != exact.Commits {
+		t.Errorf("Exact counts differ. want %d events, %d commits; got %d events, %d commits",
+			exact.TotalEvents, exact.Commits, approx.TotalEvents, approx.Commits)
+	}
+	if d := approx.Actors - exact.Actors; d < -approx.Error.Actors || d > approx.Error.Actors {
+		t.Errorf("Estimated actors out of bounds. want %d (±%d); got %d", exact.Actors, approx.Error.Actors, approx.Actors)
+	}
+	if d := approx.Repos - exact.Repos; d < -approx.Error.Repos || d > approx.Error.Repos {
+		t.Errorf("Estimated repos out of bounds. want %d (±%d); got %d", exact.Repos, approx.Error.Repos, approx.Repos)
+	}
+	if d := math.Abs(approx.TopUsersShare - exact.TopUsersShare); d > approx.Error.TopUsersShare+1e-9 {
+		t.Errorf("Estimated top users share out of bounds. want %v (±%v); got %v",
+			exact.TopUsersShare, approx.Error.TopUsersShare, approx.TopUsersShare)
+	}
+	if exact.Error != nil {
+		t.Errorf("Exact summary reports error bounds %+v", exact.Error)
+	}
+}
+
+func TestListApproximateBots(t *testing.T) {
+	an := analytics.New(createStore(t))
+
+	for _, filter := range []analytics.BotFilter{analytics.ExcludeBots, analytics.OnlyBots} {
+		_, err := an.ListUsers(analytics.Approximate(true), analytics.Bots(filter))
+		var optionErr *analytics.OptionError
+		if !errors.As(err, &optionErr) {
+			t.Errorf("Bots(%q) err got %v, want OptionError", filter, err)
+		}
+	}
+
+	if _, err := an.ListUsers(analytics.Approximate(true), analytics.Bots(analytics.AllActors)); err != nil {
+		t.Errorf("Bots(%q) err got %v, want nil", analytics.AllActors, err)
+	}
+}
+
+func TestListOwnersApproximate(t *testing.T) {
+	an := analytics.New(createStore(t))
+
+	if _, err := an.ListOwners(analytics.Approximate(true)); err == nil {
+		t.Error("expected error for approximate owners ranking; got nil")
+	}
+}
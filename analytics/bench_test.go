@@ -0,0 +1,161 @@
+package analytics_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+	"github.com/dikaeinstein/ghanalytics/data"
+)
+
+// loadBundledStore loads the CSV dataset shipped in the data directory.
+func loadBundledStore(b *testing.B) *data.Store {
+	b.Helper()
+
+	open := func(name string) *os.File {
+		f, err := os.Open(filepath.Join("..", "data", name+".csv"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { f.Close() })
+		return f
+	}
+
+	store, err := data.NewStore(open("actors"), open("commits"), open("events"), open("repos"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return store
+}
+
+func BenchmarkListUsers(b *testing.B) {
+	store := loadBundledStore(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := analytics.New(store).ListUsers(
+			analytics.Sort([]analytics.SortCriteria{analytics.CommitsPushed, analytics.PrCreated}),
+			analytics.Limit(10),
+		)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkListReposForActor(b *testing.B) {
+	store := loadBundledStore(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := analytics.New(store).ListRepos(
+			analytics.Sort([]analytics.SortCriteria{analytics.CommitsPushed}),
+			analytics.ForActor(29139614),
+			analytics.Limit(10),
+		)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// syntheticSizes are the numbers of events of the synthetic datasets the
+// rankings are benchmarked on, showing how they scale.
+var syntheticSizes = []int{1_000_000, 2_000_000, 4_000_000}
+
+// syntheticStore generates a dataset of the given number of events, their
+// actors and repositories following a Zipf distribution as in the GH
+// Archive, where few users and repositories account for most activity.
+func syntheticStore(b *testing.B, events int) *data.Store {
+	b.Helper()
+
+	actors, repos := uint64(events/20), uint64(events/10)
+	rnd := rand.New(rand.NewSource(1))
+	actorIDs := rand.NewZipf(rnd, 1.1, 1, actors-1)
+	repoIDs := rand.NewZipf(rnd, 1.1, 1, repos-1)
+	eventTypes := []analytics.EventType{
+		analytics.PushEvent, analytics.PushEvent, analytics.PushEvent, analytics.PushEvent,
+		analytics.PullRequestEvent, analytics.WatchEvent, analytics.WatchEvent,
+		analytics.CreateEvent, analytics.IssueCommentEvent, analytics.ForkEvent,
+	}
+
+	var actorsCSV, reposCSV, eventsCSV, commitsCSV bytes.Buffer
+	actorsCSV.WriteString("id,username\n")
+	for id := uint64(1); id <= actors; id++ {
+		fmt.Fprintf(&actorsCSV, "%d,user%d\n", id, id)
+	}
+	reposCSV.WriteString("id,name\n")
+	for id := uint64(1); id <= repos; id++ {
+		fmt.Fprintf(&reposCSV, "%d,owner%d/repo%d\n", id, id%1000, id)
+	}
+	eventsCSV.WriteString("id,type,actor_id,repo_id\n")
+	commitsCSV.WriteString("sha,message,event_id\n")
+	sha := 0
+	for id := 1; id <= events; id++ {
+		evt := eventTypes[rnd.Intn(len(eventTypes))]
+		fmt.Fprintf(&eventsCSV, "%d,%s,%d,%d\n", id, evt, actorIDs.Uint64()+1, repoIDs.Uint64()+1)
+		if evt != analytics.PushEvent {
+			continue
+		}
+		for n := rnd.Intn(3); n > 0; n-- {
+			sha++
+			fmt.Fprintf(&commitsCSV, "%x,Commit,%d\n", sha, id)
+		}
+	}
+
+	store, err := data.NewStore(&actorsCSV, &commitsCSV, &eventsCSV, &reposCSV)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return store
+}
+
+func BenchmarkListUsersSynthetic(b *testing.B) {
+	benchmarkSynthetic(b, func(an *analytics.Analytics, options ...func(*analytics.Analytics) error) error {
+		_, err := an.ListUsers(append(options,
+			analytics.Sort([]analytics.SortCriteria{analytics.CommitsPushed, analytics.PrCreated}),
+		)...)
+		return err
+	})
+}
+
+func BenchmarkListReposSynthetic(b *testing.B) {
+	benchmarkSynthetic(b, func(an *analytics.Analytics, options ...func(*analytics.Analytics) error) error {
+		_, err := an.ListRepos(append(options,
+			analytics.Sort([]analytics.SortCriteria{analytics.CommitsPushed}),
+		)...)
+		return err
+	})
+}
+
+// benchmarkSynthetic runs list on every synthetic dataset, selecting the top
+// 10 entries exactly and approximately, and ranking every entry.
+func benchmarkSynthetic(b *testing.B, list func(an *analytics.Analytics, options ...func(*analytics.Analytics) error) error) {
+	modes := []struct {
+		name    string
+		options []func(*analytics.Analytics) error
+	}{
+		{"limit=10", []func(*analytics.Analytics) error{analytics.Limit(10)}},
+		{"limit=10/approx", []func(*analytics.Analytics) error{analytics.Limit(10), analytics.Approximate(true)}},
+		{"limit=0", []func(*analytics.Analytics) error{analytics.Limit(0)}},
+	}
+
+	for _, size := range syntheticSizes {
+		an := analytics.New(syntheticStore(b, size))
+
+		for _, mode := range modes {
+			b.Run(fmt.Sprintf("events=%d/%s", size, mode.name), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if err := list(an, mode.options...); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dikaeinstein/ghanalytics/aggregate"
+)
+
+// BotFilter selects the actors, bots or humans, whose events ListUsers,
+// ListRepos and ListOwners consider.
+type BotFilter string
+
+const (
+	// AllActors considers the events of every actor.
+	AllActors BotFilter = ""
+	// ExcludeBots leaves out the events of detected bots.
+	ExcludeBots BotFilter = "exclude"
+	// OnlyBots considers the events of detected bots only.
+	OnlyBots BotFilter = "only"
+)
+
+// Reasons an actor is detected as a bot.
+const (
+	BotSuffix          = "[bot] suffix"
+	BotNamePattern     = "name pattern"
+	BotRegularCadence  = "regular push cadence"
+	BotCommitTemplates = "templated commit messages"
+)
+
+// DefaultBotPatterns are the username patterns detecting bots unless
+// BotPatterns is given, matching names such as "bitnami-bot" or "LombiqBot".
+var DefaultBotPatterns = []string{`(?i)[-_.]bot$`, `[a-z0-9]Bot$`}
+
+const (
+	// minCadencePushes is the number of pushes needed to tell whether their
+	// cadence is regular, maxCadenceVariation the largest coefficient of
+	// variation of the intervals between pushes considered regular.
+	minCadencePushes    = 5
+	maxCadenceVariation = 0.1
+
+	// minTemplateCommits is the number of commits needed to tell whether
+	// their messages follow a template, minTemplateShare the fraction of
+	// them sharing the same one. The template must have at least
+	// minTemplateVariants distinct instances, pushed over at least
+	// minTemplatePushes pushes.
+	minTemplateCommits  = 20
+	minTemplateShare    = 0.9
+	minTemplateVariants = 5
+	minTemplatePushes   = 5
+)
+
+// Bot is an actor detected as a bot, along with the reasons it was.
+type Bot struct {
+	Actor
+	Reasons []string `json:"reasons"`
+}
+
+// Bots restricts the events ranked to those of bots or humans, as told by
+// DetectBots. It defaults to AllActors.
+func Bots(filter BotFilter) func(*Analytics) error {
+	return func(a *Analytics) error {
+		return a.setListOptionsBots(filter)
+	}
+}
+
+// BotPatterns replaces DefaultBotPatterns with the given regular expressions
+// matched against usernames.
+func BotPatterns(patterns []string) func(*Analytics) error {
+	return func(a *Analytics) error {
+		return a.setListOptionsBotPatterns(patterns)
+	}
+}
+
+func (a *Analytics) setListOptionsBots(filter BotFilter) error {
+	switch filter {
+	case AllActors, ExcludeBots, OnlyBots:
+		a.listOptions.bots = filter
+		return nil
+	default:
+		return fmt.Errorf("invalid bot filter %q: must be %q or %q", filter, ExcludeBots, OnlyBots)
+	}
+}
+
+func (a *Analytics) setListOptionsBotPatterns(patterns []string) error {
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("invalid bot pattern %q: %w", p, err)
+		}
+		compiled[i] = re
+	}
+	a.listOptions.botPatterns = compiled
+	return nil
+}
+
+// DetectBots returns the actors having events within the time window that
+// look like bots, ordered by username. An actor is a bot when its username
+// ends with "[bot]" or matches one of the bot patterns, when it pushes at an
+// abnormally regular cadence, or when the messages of the commits it pushes
+// follow the same template.
+func (a *Analytics) DetectBots(options ...func(*Analytics) error) ([]Bot, error) {
+	return a.DetectBotsContext(context.Background(), options...)
+}
+
+// DetectBotsContext is like DetectBots, aborting with the context's error once
+// ctx is done.
+func (a *Analytics) DetectBotsContext(ctx context.Context, options ...func(*Analytics) error) ([]Bot, error) {
+	call, err := a.parseListOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	reasonsByID, err := call.detectBots(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint64, 0, len(reasonsByID))
+	for id := range reasonsByID {
+		ids = append(ids, id)
+	}
+	users, err := call.store.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	usersByID := make(map[uint64]Actor, len(users))
+	for _, u := range users {
+		usersByID[u.ID] = u
+	}
+	bots := make([]Bot, 0, len(ids))
+	for _, id := range ids {
+		u, ok := usersByID[id]
+		if !ok {
+			// the user is missing from the store, keep what the events tell
+			u = Actor{ID: id}
+		}
+		bots = append(bots, Bot{Actor: u, Reasons: reasonsByID[id]})
+	}
+	sort.Slice(bots, func(i, j int) bool {
+		ni, nj := strings.ToLower(bots[i].Username), strings.ToLower(bots[j].Username)
+		if ni != nj {
+			return ni < nj
+		}
+		return bots[i].ID < bots[j].ID
+	})
+
+	return bots, nil
+}
+
+// detectBots returns the reasons each actor having events in scope is
+// detected as a bot, by actor ID.
+func (a *Analytics) detectBots(ctx context.Context) (map[uint64][]string, error) {
+	actorIDs := make(map[uint64]bool)
+	pushTimes := make(map[uint64][]time.Time)
+	actorByPushID := make(map[uint64]uint64)
+	var pushIDs []uint64
+	err := a.store.ForEachEvent(ctx, a.eventFilter(nil), func(e Event, commits int) error {
+		actorIDs[e.ActorID] = true
+		if e.Type != PushEvent {
+			return nil
+		}
+		if !e.CreatedAt.IsZero() {
+			pushTimes[e.ActorID] = append(pushTimes[e.ActorID], e.CreatedAt)
+		}
+		if commits > 0 {
+			actorByPushID[e.ID] = e.ActorID
+			pushIDs = append(pushIDs, e.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reasonsByID := make(map[uint64][]string)
+
+	ids := make([]uint64, 0, len(actorIDs))
+	for id := range actorIDs {
+		ids = append(ids, id)
+	}
+	users, err := a.store.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	patterns := a.listOptions.botPatterns
+	if patterns == nil {
+		patterns = defaultBotPatterns
+	}
+	for _, u := range users {
+		if strings.HasSuffix(u.Username, "[bot]") {
+			reasonsByID[u.ID] = append(reasonsByID[u.ID], BotSuffix)
+			continue
+		}
+		for _, re := range patterns {
+			if re.MatchString(u.Username) {
+				reasonsByID[u.ID] = append(reasonsByID[u.ID], BotNamePattern)
+				break
+			}
+		}
+	}
+
+	for id, times := range pushTimes {
+		if regularCadence(times) {
+			reasonsByID[id] = append(reasonsByID[id], BotRegularCadence)
+		}
+	}
+
+	commits, err := a.store.GetCommitsByEventIDs(ctx, pushIDs)
+	if err != nil {
+		return nil, err
+	}
+	commitsByActor := aggregate.GroupBy(commits, func(c Commit) uint64 { return actorByPushID[c.EventID] })
+	for id, commits := range commitsByActor {
+		if templated(commits) {
+			reasonsByID[id] = append(reasonsByID[id], BotCommitTemplates)
+		}
+	}
+
+	return reasonsByID, nil
+}
+
+var defaultBotPatterns = func() []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, len(DefaultBotPatterns))
+	for i, p := range DefaultBotPatterns {
+		compiled[i] = regexp.MustCompile(p)
+	}
+	return compiled
+}()
+
+// regularCadence tells whether the intervals between the push times barely
+// vary, as when pushing on a schedule.
+func regularCadence(times []time.Time) bool {
+	if len(times) < minCadencePushes {
+		return false
+	}
+
+	sorted := append([]time.Time{}, times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	intervals := make([]float64, len(sorted)-1)
+	var mean float64
+	for i := 1; i < len(sorted); i++ {
+		intervals[i-1] = sorted[i].Sub(sorted[i-1]).Seconds()
+		mean += intervals[i-1]
+	}
+	mean /= float64(len(intervals))
+	if mean == 0 {
+		return false
+	}
+
+	var variance float64
+	for _, d := range intervals {
+		variance += (d - mean) * (d - mean)
+	}
+	variance /= float64(len(intervals))
+
+	return math.Sqrt(variance)/mean <= maxCadenceVariation
+}
+
+// templateVariables matches the parts of commit messages varying between
+// instances of a template: numbers, versions and hashes. Words spelled with
+// hex letters alone, such as "defaced", match too, see template.
+var templateVariables = regexp.MustCompile(`\b[0-9a-f]{7,40}\b|v?[0-9]+([.\-][0-9A-Za-z]+)*`)
+
+// template returns subject with its variable parts replaced by "#", leaving
+// the matches without any digit alone as they are words rather than hashes.
+func template(subject string) string {
+	return templateVariables.ReplaceAllStringFunc(subject, func(m string) string {
+		if !strings.ContainsAny(m, "0123456789") {
+			return m
+		}
+		return "#"
+	})
+}
+
+// templated tells whether the messages of most commits are instances of the
+// same template: distinct messages, pushed over several pushes, that are the
+// same once their variable parts are left out. A message repeated as is, as
+// people do too, is no template.
+func templated(commits []Commit) bool {
+	if len(commits) < minTemplateCommits {
+		return false
+	}
+
+	subject := func(c Commit) string {
+		if i := strings.IndexByte(c.Message, '\n'); i >= 0 {
+			return c.Message[:i]
+		}
+		return c.Message
+	}
+	byTemplate := aggregate.GroupBy(commits, func(c Commit) string { return template(subject(c)) })
+
+	for _, instances := range byTemplate {
+		if float64(len(instances)) < minTemplateShare*float64(len(commits)) {
+			continue
+		}
+		variants := aggregate.Distinct(instances, subject)
+		pushes := aggregate.Distinct(instances, func(c Commit) uint64 { return c.EventID })
+		return len(variants) >= minTemplateVariants && len(pushes) >= minTemplatePushes
+	}
+	return false
+}
+
+// botFilter returns whether the Bots option keeps the events of the actor
+// with the given ID, or nil when it keeps every actor's.
+func (a *Analytics) botFilter(ctx context.Context) (func(actorID uint64) bool, error) {
+	if a.listOptions.bots == AllActors {
+		return nil, nil
+	}
+
+	reasonsByID, err := a.detectBots(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keepBots := a.listOptions.bots == OnlyBots
+	return func(actorID uint64) bool {
+		_, bot := reasonsByID[actorID]
+		return bot == keepBots
+	}, nil
+}
@@ -0,0 +1,215 @@
+package analytics_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+	"github.com/dikaeinstein/ghanalytics/data"
+)
+
+func createBotsStore(t *testing.T) analytics.Store {
+	t.Helper()
+
+	// updater bumps the version over its five pushes, while carol repeats
+	// the same message as is
+	commits := "sha,message,event_id\na1,Fix typo,10\na2,Add tests,11\n"
+	for i := 0; i < 20; i++ {
+		commits += fmt.Sprintf("u%d,Bump version to 1.0.%d,%d\n", i, i+1, 50+i/4)
+	}
+	for i := 0; i < 25; i++ {
+		commits += fmt.Sprintf("c%d,get frequency of subcateg,%d\n", i, 70+i/5)
+	}
+
+	store, err := data.NewStore(
+		strings.NewReader(`id,username
+1,alice
+2,renovate[bot]
+3,LombiqBot
+4,scheduler
+5,updater
+6,bob
+7,carol`),
+		strings.NewReader(commits),
+		strings.NewReader(`id,type,actor_id,repo_id,created_at
+10,PushEvent,1,100,2020-01-01T15:00:00Z
+11,PushEvent,1,100,2020-01-01T15:07:00Z
+12,PullRequestEvent,1,100,2020-01-01T15:30:00Z
+20,PullRequestEvent,2,100,2020-01-01T15:01:00Z
+30,PushEvent,3,200,2020-01-01T15:02:00Z
+40,PushEvent,4,200,2020-01-01T15:00:00Z
+41,PushEvent,4,200,2020-01-01T15:10:00Z
+42,PushEvent,4,200,2020-01-01T15:20:00Z
+43,PushEvent,4,200,2020-01-01T15:30:00Z
+44,PushEvent,4,200,2020-01-01T15:40:00Z
+50,PushEvent,5,300,2020-01-01T15:01:00Z
+51,PushEvent,5,300,2020-01-01T15:03:00Z
+52,PushEvent,5,300,2020-01-01T15:11:00Z
+53,PushEvent,5,300,2020-01-01T15:12:00Z
+54,PushEvent,5,300,2020-01-01T15:40:00Z
+60,PullRequestEvent,6,300,2020-01-01T15:05:00Z
+70,PushEvent,7,100,2020-01-01T16:00:00Z
+71,PushEvent,7,100,2020-01-01T16:02:00Z
+72,PushEvent,7,100,2020-01-01T16:30:00Z
+73,PushEvent,7,100,2020-01-01T16:31:00Z
+74,PushEvent,7,100,2020-01-01T17:45:00Z`),
+		strings.NewReader("id,name\n100,team/app\n200,team/site\n300,team/lib"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestDetectBots(t *testing.T) {
+	store := createBotsStore(t)
+
+	bots, err := analytics.New(store).DetectBots()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []analytics.Bot{
+		{Actor: analytics.Actor{ID: 3, Username: "LombiqBot"}, Reasons: []string{analytics.BotNamePattern}},
+		{Actor: analytics.Actor{ID: 2, Username: "renovate[bot]"}, Reasons: []string{analytics.BotSuffix}},
+		{Actor: analytics.Actor{ID: 4, Username: "scheduler"}, Reasons: []string{analytics.BotRegularCadence}},
+		{Actor: analytics.Actor{ID: 5, Username: "updater"}, Reasons: []string{analytics.BotCommitTemplates}},
+	}
+	if !reflect.DeepEqual(bots, expected) {
+		t.Errorf("Wrong bots returned. want %+v; got %+v", expected, bots)
+	}
+
+	bots, err = analytics.New(store).DetectBots(analytics.BotPatterns([]string{"^bob$"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(bots))
+	for i, b := range bots {
+		names[i] = b.Username
+	}
+	expectedNames := []string{"bob", "renovate[bot]", "scheduler", "updater"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("Wrong bots returned. want %v; got %v", expectedNames, names)
+	}
+
+	if _, err := analytics.New(store).DetectBots(analytics.BotPatterns([]string{"("})); err == nil {
+		t.Error("expected error for invalid bot pattern; got nil")
+	}
+}
+
+func TestDetectBotsUnknownUsers(t *testing.T) {
+	// dave's messages differ by words spelled with hex letters, while the
+	// actor 9 pushing on a schedule is missing from the users
+	words := []string{"defaced", "acceded", "effaced", "deadbeef", "baddeed"}
+	commits := "sha,message,event_id\n"
+	for i := 0; i < 20; i++ {
+		commits += fmt.Sprintf("d%d,Restore the %s page,%d\n", i, words[i%5], 10+i/4)
+	}
+
+	store, err := data.NewStore(
+		strings.NewReader("id,username\n1,dave"),
+		strings.NewReader(commits),
+		strings.NewReader(`id,type,actor_id,repo_id,created_at
+10,PushEvent,1,100,2020-01-01T15:00:00Z
+11,PushEvent,1,100,2020-01-01T15:02:00Z
+12,PushEvent,1,100,2020-01-01T15:30:00Z
+13,PushEvent,1,100,2020-01-01T15:31:00Z
+14,PushEvent,1,100,2020-01-01T17:45:00Z
+90,PushEvent,9,100,2020-01-01T15:00:00Z
+91,PushEvent,9,100,2020-01-01T15:10:00Z
+92,PushEvent,9,100,2020-01-01T15:20:00Z
+93,PushEvent,9,100,2020-01-01T15:30:00Z
+94,PushEvent,9,100,2020-01-01T15:40:00Z`),
+		strings.NewReader("id,name\n100,team/app"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bots, err := analytics.New(store).DetectBots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []analytics.Bot{
+		{Actor: analytics.Actor{ID: 9}, Reasons: []string{analytics.BotRegularCadence}},
+	}
+	if !reflect.DeepEqual(bots, expected) {
+		t.Errorf("Wrong bots returned. want %+v; got %+v", expected, bots)
+	}
+
+	users, err := analytics.New(store).ListUsers(
+		analytics.Sort([]analytics.SortCriteria{analytics.Pushes}),
+		analytics.Bots(analytics.OnlyBots),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].ID != 9 {
+		t.Errorf("Wrong users returned. want [9]; got %+v", users)
+	}
+}
+
+func TestListBotFilter(t *testing.T) {
+	store := createBotsStore(t)
+
+	testCases := []struct {
+		desc          string
+		filter        analytics.BotFilter
+		expectedUsers []string
+		expectedRepos []string
+	}{
+		{
+			desc:          "All actors",
+			filter:        analytics.AllActors,
+			expectedUsers: []string{"scheduler", "updater", "carol", "alice", "LombiqBot", "renovate[bot]", "bob"},
+			expectedRepos: []string{"team/app", "team/site", "team/lib"},
+		},
+		{
+			desc:          "Exclude bots",
+			filter:        analytics.ExcludeBots,
+			expectedUsers: []string{"carol", "alice", "bob"},
+			expectedRepos: []string{"team/app", "team/lib"},
+		},
+		{
+			desc:          "Only bots",
+			filter:        analytics.OnlyBots,
+			expectedUsers: []string{"scheduler", "updater", "LombiqBot", "renovate[bot]"},
+			expectedRepos: []string{"team/site", "team/lib", "team/app"},
+		},
+	}
+
+	criterion := analytics.Sort([]analytics.SortCriteria{analytics.Pushes, analytics.PrCreated})
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			users, err := analytics.New(store).ListUsers(criterion, analytics.Bots(tC.filter))
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, len(users))
+			for i, u := range users {
+				names[i] = u.Username
+			}
+			if !reflect.DeepEqual(names, tC.expectedUsers) {
+				t.Errorf("Wrong users returned. want %v; got %v", tC.expectedUsers, names)
+			}
+
+			repos, err := analytics.New(store).ListRepos(criterion, analytics.Bots(tC.filter))
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = make([]string, len(repos))
+			for i, r := range repos {
+				names[i] = r.Name
+			}
+			if !reflect.DeepEqual(names, tC.expectedRepos) {
+				t.Errorf("Wrong repos returned. want %v; got %v", tC.expectedRepos, names)
+			}
+		})
+	}
+
+	if _, err := analytics.New(store).ListUsers(analytics.Bots("some")); err == nil {
+		t.Error("expected error for unknown bot filter; got nil")
+	}
+}
@@ -0,0 +1,120 @@
+package analytics_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+)
+
+func TestOptionsDoNotLeak(t *testing.T) {
+	an := analytics.New(createStore(t))
+	criterion := analytics.Sort([]analytics.SortCriteria{analytics.CommitsPushed})
+
+	all, err := an.ListUsers(criterion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := an.ListUsers(criterion, analytics.Limit(1), analytics.Offset(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := an.ListUsers(criterion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, all) {
+		t.Errorf("Options of a previous call leaked. want %d users; got %d", len(all), len(again))
+	}
+}
+
+func TestConcurrentUse(t *testing.T) {
+	an := analytics.New(createStore(t))
+
+	calls := []func() (interface{}, error){
+		func() (interface{}, error) {
+			return an.ListUsers(
+				analytics.Sort([]analytics.SortCriteria{analytics.CommitsPushed, analytics.PrCreated}),
+				analytics.Limit(5),
+			)
+		},
+		func() (interface{}, error) {
+			return an.ListUsers(
+				analytics.Sort([]analytics.SortCriteria{analytics.PrCreated}),
+				analytics.Offset(3),
+				analytics.TieBreak(analytics.ByName),
+			)
+		},
+		func() (interface{}, error) {
+			return an.ListRepos(
+				analytics.Sort([]analytics.SortCriteria{analytics.Watches}),
+				analytics.Weights(map[analytics.SortCriteria]int{analytics.CommitsPushed: 2}),
+			)
+		},
+		func() (interface{}, error) {
+			return an.ListOwners(analytics.Limit(3), analytics.Bots(analytics.ExcludeBots))
+		},
+		func() (interface{}, error) { return an.Summary() },
+		func() (interface{}, error) { return an.Series(analytics.Interval(analytics.Minute)) },
+		func() (interface{}, error) { return an.DetectBots() },
+	}
+
+	// Results of the calls made one at a time
+	expected := make([]interface{}, len(calls))
+	for i, call := range calls {
+		result, err := call()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected[i] = result
+	}
+
+	const goroutines = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines*len(calls))
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for k := range calls {
+				// Interleave the calls differently in each goroutine
+				i := (g + k) % len(calls)
+				result, err := calls[i]()
+				if err != nil {
+					errs <- err
+					continue
+				}
+				if !reflect.DeepEqual(result, expected[i]) {
+					t.Errorf("Call %d returned a different result when run concurrently", i)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	an := analytics.New(createStore(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := an.ListUsersContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListUsersContext err got %v, want %v", err, context.Canceled)
+	}
+	if _, err := an.ListReposContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListReposContext err got %v, want %v", err, context.Canceled)
+	}
+	if _, err := an.SummaryContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("SummaryContext err got %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,129 @@
+package analytics
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/dikaeinstein/ghanalytics/aggregate"
+)
+
+// ownerSortCriterion ranks owners when no Sort or Weights option is given.
+var ownerSortCriterion = []SortCriteria{CommitsPushed, Pushes, PrCreated, Watches}
+
+// OwnerResult is a user or organization ranked by ListOwners, along with the
+// number of its repositories having matching events and their combined Stats.
+type OwnerResult struct {
+	Owner string `json:"owner"`
+	Repos int    `json:"repos"`
+	Stats Stats  `json:"stats"`
+}
+
+// Owner returns the owner of the repository, the prefix of its "owner/name"
+// full name.
+func (r Repo) Owner() string {
+	if i := strings.Index(r.Name, "/"); i >= 0 {
+		return r.Name[:i]
+	}
+	return r.Name
+}
+
+// ListOwners returns the owners of repositories ranked by the sort criterion
+// summed across their repositories. It defaults to ranking by commits
+// pushed, pushes, pull requests and watches combined. Ties are broken by
+// each criteria, then by owner name. Repositories missing from the store are
+// left out, their owner being unknown.
+func (a *Analytics) ListOwners(options ...func(*Analytics) error) ([]OwnerResult, error) {
+	return a.ListOwnersContext(context.Background(), options...)
+}
+
+// ListOwnersContext is like ListOwners, aborting with the context's error once
+// ctx is done.
+func (a *Analytics) ListOwnersContext(ctx context.Context, options ...func(*Analytics) error) ([]OwnerResult, error) {
+	call, err := a.parseListOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if call.listOptions.approx {
+		return nil, &OptionError{Err: errApproxOwners}
+	}
+	if len(call.listOptions.sortCriterion) == 0 && len(call.listOptions.weights) == 0 {
+		call.listOptions.sortCriterion = ownerSortCriterion
+	}
+
+	ranking, err := call.rank(ctx, func(e Event) uint64 { return e.RepoID })
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint64, len(ranking))
+	for i, r := range ranking {
+		ids[i] = r.ID
+	}
+	repos, err := call.store.GetReposByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	ownersByRepoID := make(map[uint64]string, len(repos))
+	for _, r := range repos {
+		ownersByRepoID[r.ID] = r.Owner()
+	}
+
+	// the owner of repositories missing from the store is unknown
+	known := ranking[:0]
+	for _, r := range ranking {
+		if _, ok := ownersByRepoID[r.ID]; ok {
+			known = append(known, r)
+		}
+	}
+	rankingByOwner := aggregate.GroupBy(known, func(r statsByID) string { return ownersByRepoID[r.ID] })
+
+	type ownerStats struct {
+		OwnerResult
+		criteria []int
+	}
+	owners := make([]*ownerStats, 0, len(rankingByOwner))
+	for owner, entries := range rankingByOwner {
+		o := &ownerStats{
+			OwnerResult: OwnerResult{Owner: owner, Repos: len(entries)},
+			criteria:    make([]int, len(entries[0].criteria)),
+		}
+		for _, r := range entries {
+			o.Stats.Commits += r.Stats.Commits
+			o.Stats.Pushes += r.Stats.Pushes
+			o.Stats.PullRequests += r.Stats.PullRequests
+			o.Stats.Watches += r.Stats.Watches
+			o.Stats.Total += r.Stats.Total
+			for i, v := range r.criteria {
+				o.criteria[i] += v
+			}
+		}
+		owners = append(owners, o)
+	}
+
+	less := func(oi, oj *ownerStats) bool {
+		if oi.Stats.Total != oj.Stats.Total {
+			return oi.Stats.Total > oj.Stats.Total
+		}
+		for k := range oi.criteria {
+			if oi.criteria[k] != oj.criteria[k] {
+				return oi.criteria[k] > oj.criteria[k]
+			}
+		}
+		return oi.Owner < oj.Owner
+	}
+	if call.listOptions.limit > 0 {
+		_, end := call.page(len(owners))
+		owners = aggregate.TopK(owners, end, less)
+	} else {
+		sort.Slice(owners, func(i, j int) bool { return less(owners[i], owners[j]) })
+	}
+
+	start, end := call.page(len(owners))
+	topNOwners := make([]OwnerResult, 0, end-start)
+	for _, o := range owners[start:end] {
+		topNOwners = append(topNOwners, o.OwnerResult)
+	}
+
+	return topNOwners, nil
+}
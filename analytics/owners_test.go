@@ -0,0 +1,80 @@
+package analytics_test
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+	"github.com/dikaeinstein/ghanalytics/data"
+)
+
+func TestListOwners(t *testing.T) {
+	store, err := data.NewStore(
+		strings.NewReader("id,username\n1,alice\n2,bob"),
+		strings.NewReader("sha,message,event_id\na,first,10\nb,second,10\nc,third,12"),
+		strings.NewReader(`id,type,actor_id,repo_id
+10,PushEvent,1,100
+11,WatchEvent,2,100
+12,PushEvent,2,200
+13,PullRequestEvent,1,300
+14,WatchEvent,2,300
+15,PushEvent,1,400
+16,ForkEvent,1,200`),
+		strings.NewReader("id,name\n100,acme/one\n200,acme/two\n300,zeta/one"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc     string
+		options  []func(*analytics.Analytics) error
+		expected []analytics.OwnerResult
+	}{
+		{
+			desc: "Default criteria",
+			expected: []analytics.OwnerResult{
+				{Owner: "acme", Repos: 2, Stats: analytics.Stats{Commits: 3, Pushes: 2, Watches: 1, Total: 6}},
+				{Owner: "zeta", Repos: 1, Stats: analytics.Stats{PullRequests: 1, Watches: 1, Total: 2}},
+			},
+		},
+		{
+			desc: "Sorted by watches",
+			options: []func(*analytics.Analytics) error{
+				analytics.Sort([]analytics.SortCriteria{analytics.Watches, analytics.PrCreated}),
+			},
+			expected: []analytics.OwnerResult{
+				{Owner: "zeta", Repos: 1, Stats: analytics.Stats{PullRequests: 1, Watches: 1, Total: 2}},
+				{Owner: "acme", Repos: 1, Stats: analytics.Stats{Commits: 2, Pushes: 1, Watches: 1, Total: 1}},
+			},
+		},
+		{
+			desc:    "Paginated",
+			options: []func(*analytics.Analytics) error{analytics.Offset(1), analytics.Limit(5)},
+			expected: []analytics.OwnerResult{
+				{Owner: "zeta", Repos: 1, Stats: analytics.Stats{PullRequests: 1, Watches: 1, Total: 2}},
+			},
+		},
+		{
+			desc:    "Largest limit",
+			options: []func(*analytics.Analytics) error{analytics.Offset(1), analytics.Limit(math.MaxInt)},
+			expected: []analytics.OwnerResult{
+				{Owner: "zeta", Repos: 1, Stats: analytics.Stats{PullRequests: 1, Watches: 1, Total: 2}},
+			},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			owners, err := analytics.New(store).ListOwners(tC.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(owners, tC.expected) {
+				t.Errorf("Wrong owners returned. want %+v; got %+v", tC.expected, owners)
+			}
+		})
+	}
+}
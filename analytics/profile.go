@@ -0,0 +1,341 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ErrNotFound is returned, wrapped, by UserProfile and RepoProfile when no
+// user or repository matches the key.
+var ErrNotFound = errors.New("not found")
+
+// sampleCommits is the number of commit messages a profile samples.
+const sampleCommits = 5
+
+// Rank is the position of a user or repository in the leaderboard of a
+// single sort criteria, out of the Entries ranked in it.
+type Rank struct {
+	Criteria SortCriteria `json:"criteria"`
+	Value    int          `json:"value"`
+	Position int          `json:"position"`
+	Entries  int          `json:"entries"`
+}
+
+// UserProfile is the activity of a single user within the time window.
+type UserProfile struct {
+	Actor
+	Events  map[EventType]int `json:"events"`
+	Commits int               `json:"commits"`
+
+	// Repos are the repositories the user has events in, most active
+	// first.
+	Repos []Repo `json:"repos"`
+
+	// SampleCommitMessages are the messages of the latest commits pushed.
+	SampleCommitMessages []string `json:"sampleCommitMessages"`
+
+	// Ranks are the user's positions in the leaderboard of every criteria
+	// it has events for.
+	Ranks []Rank `json:"ranks"`
+}
+
+// RepoProfile is the activity of a single repository within the time
+// window.
+type RepoProfile struct {
+	Repo
+	Events  map[EventType]int `json:"events"`
+	Commits int               `json:"commits"`
+
+	// Contributors are the users having events in the repository, most
+	// active first.
+	Contributors []Actor `json:"contributors"`
+
+	// SampleCommitMessages are the messages of the latest commits pushed.
+	SampleCommitMessages []string `json:"sampleCommitMessages"`
+
+	// Ranks are the repository's positions in the leaderboard of every
+	// criteria it has events for.
+	Ranks []Rank `json:"ranks"`
+}
+
+// profile is the activity of the user or repository identified by id.
+type profile struct {
+	events   map[EventType]int
+	commits  int
+	others   []uint64
+	messages []string
+	ranks    []Rank
+}
+
+// UserProfile returns the profile of the user identified by key, an ID or a
+// username. Leaderboard positions honor the Since, Until and Bots options,
+// ties being broken by ID.
+func (a *Analytics) UserProfile(key string, options ...func(*Analytics) error) (UserProfile, error) {
+	return a.UserProfileContext(context.Background(), key, options...)
+}
+
+// UserProfileContext is like UserProfile, aborting with the context's error once
+// ctx is done.
+func (a *Analytics) UserProfileContext(ctx context.Context, key string, options ...func(*Analytics) error) (UserProfile, error) {
+	call, err := a.parseListOptions(options)
+	if err != nil {
+		return UserProfile{}, err
+	}
+
+	user, err := call.findUser(ctx, key)
+	if err != nil {
+		return UserProfile{}, err
+	}
+
+	p, err := call.profile(ctx,
+		func(e Event) uint64 { return e.ActorID },
+		func(e Event) uint64 { return e.RepoID },
+		user.ID,
+	)
+	if err != nil {
+		return UserProfile{}, err
+	}
+	if user.Username == "" && len(p.events) == 0 {
+		return UserProfile{}, fmt.Errorf("user %q %w", key, ErrNotFound)
+	}
+
+	found, err := call.store.GetReposByIDs(ctx, p.others)
+	if err != nil {
+		return UserProfile{}, err
+	}
+	reposByID := make(map[uint64]Repo, len(found))
+	for _, r := range found {
+		reposByID[r.ID] = r
+	}
+	repos := make([]Repo, len(p.others))
+	for i, id := range p.others {
+		repo, ok := reposByID[id]
+		if !ok {
+			repo = Repo{ID: id}
+		}
+		repos[i] = repo
+	}
+
+	return UserProfile{
+		Actor:                user,
+		Events:               p.events,
+		Commits:              p.commits,
+		Repos:                repos,
+		SampleCommitMessages: p.messages,
+		Ranks:                p.ranks,
+	}, nil
+}
+
+// RepoProfile returns the profile of the repository identified by key, an ID
+// or an "owner/name" full name. Leaderboard positions honor the Since, Until
+// and Bots options, ties being broken by ID.
+func (a *Analytics) RepoProfile(key string, options ...func(*Analytics) error) (RepoProfile, error) {
+	return a.RepoProfileContext(context.Background(), key, options...)
+}
+
+// RepoProfileContext is like RepoProfile, aborting with the context's error once
+// ctx is done.
+func (a *Analytics) RepoProfileContext(ctx context.Context, key string, options ...func(*Analytics) error) (RepoProfile, error) {
+	call, err := a.parseListOptions(options)
+	if err != nil {
+		return RepoProfile{}, err
+	}
+
+	repo, err := call.findRepo(ctx, key)
+	if err != nil {
+		return RepoProfile{}, err
+	}
+
+	p, err := call.profile(ctx,
+		func(e Event) uint64 { return e.RepoID },
+		func(e Event) uint64 { return e.ActorID },
+		repo.ID,
+	)
+	if err != nil {
+		return RepoProfile{}, err
+	}
+	if repo.Name == "" && len(p.events) == 0 {
+		return RepoProfile{}, fmt.Errorf("repository %q %w", key, ErrNotFound)
+	}
+
+	found, err := call.store.GetUsersByIDs(ctx, p.others)
+	if err != nil {
+		return RepoProfile{}, err
+	}
+	usersByID := make(map[uint64]Actor, len(found))
+	for _, u := range found {
+		usersByID[u.ID] = u
+	}
+	users := make([]Actor, len(p.others))
+	for i, id := range p.others {
+		user, ok := usersByID[id]
+		if !ok {
+			user = Actor{ID: id}
+		}
+		users[i] = user
+	}
+
+	return RepoProfile{
+		Repo:                 repo,
+		Events:               p.events,
+		Commits:              p.commits,
+		Contributors:         users,
+		SampleCommitMessages: p.messages,
+		Ranks:                p.ranks,
+	}, nil
+}
+
+// findUser returns the user with the given username, or ID when key is a
+// number no username matches. Users only known from their events are
+// returned with their ID alone.
+func (a *Analytics) findUser(ctx context.Context, key string) (Actor, error) {
+	users, err := a.store.GetUsersByNames(ctx, []string{key})
+	if err != nil {
+		return Actor{}, err
+	}
+	if len(users) > 0 {
+		return users[0], nil
+	}
+
+	id, err := strconv.ParseUint(key, 10, 64)
+	if err != nil {
+		return Actor{}, fmt.Errorf("user %q %w", key, ErrNotFound)
+	}
+	users, err = a.store.GetUsersByIDs(ctx, []uint64{id})
+	if err != nil {
+		return Actor{}, err
+	}
+	if len(users) > 0 {
+		return users[0], nil
+	}
+	return Actor{ID: id}, nil
+}
+
+// findRepo returns the repository with the given full name, or ID when key
+// is a number. Repositories only known from their events are returned with
+// their ID alone.
+func (a *Analytics) findRepo(ctx context.Context, key string) (Repo, error) {
+	repos, err := a.store.GetReposByNames(ctx, []string{key})
+	if err != nil {
+		return Repo{}, err
+	}
+	if len(repos) > 0 {
+		return repos[0], nil
+	}
+
+	id, err := strconv.ParseUint(key, 10, 64)
+	if err != nil {
+		return Repo{}, fmt.Errorf("repository %q %w", key, ErrNotFound)
+	}
+	repos, err = a.store.GetReposByIDs(ctx, []uint64{id})
+	if err != nil {
+		return Repo{}, err
+	}
+	if len(repos) > 0 {
+		return repos[0], nil
+	}
+	return Repo{ID: id}, nil
+}
+
+// profile returns the activity of the entry identified by id, where key
+// identifies the entry of an event and other its counterpart: the
+// repository of a user's event, or the user of a repository's.
+func (a *Analytics) profile(ctx context.Context, key, other func(Event) uint64, id uint64) (profile, error) {
+	keep, err := a.botFilter(ctx)
+	if err != nil {
+		return profile{}, err
+	}
+
+	p := profile{events: make(map[EventType]int)}
+	values := make(map[SortCriteria]map[uint64]int)
+	add := func(c SortCriteria, id uint64, n int) {
+		if values[c] == nil {
+			values[c] = make(map[uint64]int)
+		}
+		values[c][id] += n
+	}
+
+	eventsByOther := make(map[uint64]int)
+	var pushIDs []uint64
+	err = a.store.ForEachEvent(ctx, a.eventFilter(nil), func(e Event, commits int) error {
+		if keep != nil && !keep(e.ActorID) {
+			return nil
+		}
+
+		c := SortCriteria(e.Type)
+		if e.Type == PullRequestEvent {
+			c = PrCreated
+		}
+		add(c, key(e), 1)
+		if e.Type == PushEvent {
+			add(CommitsPushed, key(e), commits)
+		}
+
+		if key(e) != id {
+			return nil
+		}
+		p.events[e.Type]++
+		eventsByOther[other(e)]++
+		if e.Type == PushEvent {
+			p.commits += commits
+			pushIDs = append(pushIDs, e.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return profile{}, err
+	}
+
+	for o := range eventsByOther {
+		p.others = append(p.others, o)
+	}
+	sort.Slice(p.others, func(i, j int) bool {
+		ni, nj := eventsByOther[p.others[i]], eventsByOther[p.others[j]]
+		if ni != nj {
+			return ni > nj
+		}
+		return p.others[i] < p.others[j]
+	})
+
+	commits, err := a.store.GetCommitsByEventIDs(ctx, pushIDs)
+	if err != nil {
+		return profile{}, err
+	}
+	for i := len(commits) - 1; i >= 0 && len(p.messages) < sampleCommits; i-- {
+		p.messages = append(p.messages, commits[i].Message)
+	}
+
+	// the other criteria are the event types found, in name order
+	var byType []SortCriteria
+	for c := range values {
+		if c != CommitsPushed && c != PrCreated {
+			byType = append(byType, c)
+		}
+	}
+	sort.Slice(byType, func(i, j int) bool { return byType[i] < byType[j] })
+	criterion := append([]SortCriteria{CommitsPushed, PrCreated}, byType...)
+	for _, c := range criterion {
+		value := values[c][id]
+		if value == 0 {
+			continue
+		}
+
+		position := 1
+		for otherID, v := range values[c] {
+			if v > value || (v == value && otherID < id) {
+				position++
+			}
+		}
+		p.ranks = append(p.ranks, Rank{
+			Criteria: c,
+			Value:    value,
+			Position: position,
+			Entries:  len(values[c]),
+		})
+	}
+
+	return p, nil
+}
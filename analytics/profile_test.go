@@ -0,0 +1,113 @@
+package analytics_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+	"github.com/dikaeinstein/ghanalytics/data"
+)
+
+func createProfileStore(t *testing.T) analytics.Store {
+	t.Helper()
+
+	store, err := data.NewStore(
+		strings.NewReader("id,username\n1,alice\n2,bob\n3,carol"),
+		strings.NewReader(`sha,message,event_id
+a1,first,10
+a2,second,10
+b1,third,11
+c1,fourth,13`),
+		strings.NewReader(`id,type,actor_id,repo_id
+10,PushEvent,1,100
+11,PushEvent,2,100
+12,PullRequestEvent,1,200
+13,PushEvent,1,100
+14,WatchEvent,3,100
+15,PullRequestEvent,2,300`),
+		strings.NewReader("id,name\n100,team/app\n200,team/site"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestUserProfile(t *testing.T) {
+	store := createProfileStore(t)
+
+	expected := analytics.UserProfile{
+		Actor: analytics.Actor{ID: 1, Username: "alice"},
+		Events: map[analytics.EventType]int{
+			analytics.PushEvent: 2, analytics.PullRequestEvent: 1,
+		},
+		Commits:              3,
+		Repos:                []analytics.Repo{{ID: 100, Name: "team/app"}, {ID: 200, Name: "team/site"}},
+		SampleCommitMessages: []string{"fourth", "second", "first"},
+		Ranks: []analytics.Rank{
+			{Criteria: analytics.CommitsPushed, Value: 3, Position: 1, Entries: 2},
+			{Criteria: analytics.PrCreated, Value: 1, Position: 1, Entries: 2},
+			{Criteria: analytics.Pushes, Value: 2, Position: 1, Entries: 2},
+		},
+	}
+
+	for _, key := range []string{"alice", "ALICE", "1"} {
+		t.Run(key, func(t *testing.T) {
+			p, err := analytics.New(store).UserProfile(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(p, expected) {
+				t.Errorf("Wrong profile returned. want %+v; got %+v", expected, p)
+			}
+		})
+	}
+
+	if _, err := analytics.New(store).UserProfile("nobody"); err == nil {
+		t.Error("expected error for unknown user; got nil")
+	}
+	if _, err := analytics.New(store).UserProfile("42"); err == nil {
+		t.Error("expected error for unknown user ID; got nil")
+	}
+}
+
+func TestRepoProfile(t *testing.T) {
+	store := createProfileStore(t)
+
+	p, err := analytics.New(store).RepoProfile("team/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := analytics.RepoProfile{
+		Repo: analytics.Repo{ID: 100, Name: "team/app"},
+		Events: map[analytics.EventType]int{
+			analytics.PushEvent: 3, analytics.WatchEvent: 1,
+		},
+		Commits: 4,
+		Contributors: []analytics.Actor{
+			{ID: 1, Username: "alice"}, {ID: 2, Username: "bob"}, {ID: 3, Username: "carol"},
+		},
+		SampleCommitMessages: []string{"fourth", "third", "second", "first"},
+		Ranks: []analytics.Rank{
+			{Criteria: analytics.CommitsPushed, Value: 4, Position: 1, Entries: 1},
+			{Criteria: analytics.Pushes, Value: 3, Position: 1, Entries: 1},
+			{Criteria: analytics.Watches, Value: 1, Position: 1, Entries: 1},
+		},
+	}
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("Wrong profile returned. want %+v; got %+v", expected, p)
+	}
+
+	// A repository missing from the store is still known from its events
+	p, err = analytics.New(store).RepoProfile("300")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != 300 || p.Events[analytics.PullRequestEvent] != 1 {
+		t.Errorf("Wrong profile returned for repository 300; got %+v", p)
+	}
+	if len(p.Ranks) != 1 || p.Ranks[0].Position != 2 || p.Ranks[0].Entries != 2 {
+		t.Errorf("Wrong ranks returned for repository 300; got %+v", p.Ranks)
+	}
+}
@@ -0,0 +1,122 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Common Series bucket widths.
+const (
+	Minute = time.Minute
+	Hour   = time.Hour
+	Day    = 24 * time.Hour
+)
+
+// maxSeriesBuckets caps the number of buckets Series returns, so a narrow
+// interval over a wide window fails instead of exhausting memory.
+const maxSeriesBuckets = 100000
+
+// Bucket holds the number of events of each type created within the interval
+// starting at Start.
+type Bucket struct {
+	Start  time.Time         `json:"start"`
+	Counts map[EventType]int `json:"counts"`
+}
+
+// Total returns the number of events of any type within the bucket.
+func (b Bucket) Total() int {
+	total := 0
+	for _, count := range b.Counts {
+		total += count
+	}
+	return total
+}
+
+// Interval sets the width of the buckets returned by Series. It defaults
+// to Hour.
+func Interval(d time.Duration) func(*Analytics) error {
+	return func(a *Analytics) error {
+		return a.setListOptionsInterval(d)
+	}
+}
+
+func (a *Analytics) setListOptionsInterval(d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("invalid interval %v: must be positive", d)
+	}
+	a.listOptions.interval = d
+	return nil
+}
+
+// Series returns the activity over time as consecutive buckets counting the
+// events of each type, from the earliest to the latest event in scope.
+// Intervals without any event are returned as empty buckets so the series
+// has no gaps. Events without a timestamp are left out. An OptionError is
+// returned when the interval would split the events into more than 100000
+// buckets.
+func (a *Analytics) Series(options ...func(*Analytics) error) ([]Bucket, error) {
+	return a.SeriesContext(context.Background(), options...)
+}
+
+// SeriesContext is like Series, aborting with the context's error once
+// ctx is done.
+func (a *Analytics) SeriesContext(ctx context.Context, options ...func(*Analytics) error) ([]Bucket, error) {
+	call, err := a.parseListOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := call.listOptions.interval
+	if interval == 0 {
+		interval = Hour
+	}
+
+	countsByStart := make(map[time.Time]map[EventType]int)
+	err = call.store.ForEachEvent(ctx, call.eventFilter(nil), func(e Event, _ int) error {
+		if e.CreatedAt.IsZero() {
+			return nil
+		}
+
+		start := e.CreatedAt.UTC().Truncate(interval)
+		counts, ok := countsByStart[start]
+		if !ok {
+			counts = make(map[EventType]int)
+			countsByStart[start] = counts
+		}
+		counts[e.Type]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(countsByStart) == 0 {
+		return []Bucket{}, nil
+	}
+
+	starts := make([]time.Time, 0, len(countsByStart))
+	for start := range countsByStart {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	first, last := starts[0], starts[len(starts)-1]
+	n := last.Sub(first)/interval + 1
+	if n > maxSeriesBuckets {
+		return nil, &OptionError{Err: fmt.Errorf(
+			"interval %v splits the events into more than %d buckets, use a wider interval",
+			interval, maxSeriesBuckets)}
+	}
+
+	series := make([]Bucket, 0, int(n))
+	for start := first; !start.After(last); start = start.Add(interval) {
+		counts, ok := countsByStart[start]
+		if !ok {
+			counts = make(map[EventType]int)
+		}
+		series = append(series, Bucket{Start: start, Counts: counts})
+	}
+
+	return series, nil
+}
@@ -0,0 +1,138 @@
+package analytics_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+	"github.com/dikaeinstein/ghanalytics/data"
+)
+
+func TestSeries(t *testing.T) {
+	store, err := data.NewStore(
+		strings.NewReader("id,username\n1,alice\n2,bob"),
+		strings.NewReader("sha,message,event_id"),
+		strings.NewReader(`id,type,actor_id,repo_id,created_at
+1,PushEvent,1,10,2020-01-01T15:00:10Z
+2,WatchEvent,2,10,2020-01-01T15:00:50Z
+3,PushEvent,1,20,2020-01-01T15:02:00Z
+4,PushEvent,2,20,2020-01-01T16:10:00Z
+5,WatchEvent,1,20,`),
+		strings.NewReader("id,name\n10,alice/ten\n20,bob/twenty"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(hour, min int) time.Time {
+		return time.Date(2020, 1, 1, hour, min, 0, 0, time.UTC)
+	}
+
+	testCases := []struct {
+		desc     string
+		options  []func(*analytics.Analytics) error
+		expected []analytics.Bucket
+	}{
+		{
+			desc: "Hourly",
+			expected: []analytics.Bucket{
+				{Start: at(15, 0), Counts: map[analytics.EventType]int{
+					analytics.PushEvent: 2, analytics.WatchEvent: 1,
+				}},
+				{Start: at(16, 0), Counts: map[analytics.EventType]int{
+					analytics.PushEvent: 1,
+				}},
+			},
+		},
+		{
+			desc:    "By minute with gaps",
+			options: []func(*analytics.Analytics) error{analytics.Interval(analytics.Minute), analytics.Until(at(16, 0))},
+			expected: []analytics.Bucket{
+				{Start: at(15, 0), Counts: map[analytics.EventType]int{
+					analytics.PushEvent: 1, analytics.WatchEvent: 1,
+				}},
+				{Start: at(15, 1), Counts: map[analytics.EventType]int{}},
+				{Start: at(15, 2), Counts: map[analytics.EventType]int{
+					analytics.PushEvent: 1,
+				}},
+			},
+		},
+		{
+			desc:    "Scoped to repo",
+			options: []func(*analytics.Analytics) error{analytics.Interval(analytics.Day), analytics.ForRepo(20)},
+			expected: []analytics.Bucket{
+				{Start: at(0, 0), Counts: map[analytics.EventType]int{
+					analytics.PushEvent: 2,
+				}},
+			},
+		},
+		{
+			desc:    "Scoped to actor",
+			options: []func(*analytics.Analytics) error{analytics.ForActor(2)},
+			expected: []analytics.Bucket{
+				{Start: at(15, 0), Counts: map[analytics.EventType]int{
+					analytics.WatchEvent: 1,
+				}},
+				{Start: at(16, 0), Counts: map[analytics.EventType]int{
+					analytics.PushEvent: 1,
+				}},
+			},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			a := analytics.New(store)
+			series, err := a.Series(tC.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(series, tC.expected) {
+				t.Errorf("Wrong series returned. want %+v; got %+v", tC.expected, series)
+			}
+		})
+	}
+}
+
+func TestSeriesInvalidInterval(t *testing.T) {
+	a := analytics.New(createStore(t))
+	_, err := a.Series(analytics.Interval(0))
+	if err == nil {
+		t.Error("expected error for zero interval; got nil")
+	}
+}
+
+func TestSeriesTooManyBuckets(t *testing.T) {
+	store, err := data.NewStore(
+		strings.NewReader("id,username\n1,alice"),
+		strings.NewReader("sha,message,event_id"),
+		strings.NewReader(`id,type,actor_id,repo_id,created_at
+1,PushEvent,1,10,2020-01-01T00:00:00Z
+2,PushEvent,1,10,2020-01-08T00:00:00Z`),
+		strings.NewReader("id,name\n10,alice/ten"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := analytics.New(store)
+	for _, interval := range []time.Duration{time.Nanosecond, time.Millisecond} {
+		_, err := a.Series(analytics.Interval(interval))
+		var optionErr *analytics.OptionError
+		if !errors.As(err, &optionErr) {
+			t.Errorf("Series(Interval(%v)) err got %v, want OptionError", interval, err)
+		}
+	}
+
+	series, err := a.Series(analytics.Interval(analytics.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 7*24*60 + 1; len(series) != want {
+		t.Errorf("Wrong number of buckets returned. want %d; got %d", want, len(series))
+	}
+}
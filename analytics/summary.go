@@ -0,0 +1,104 @@
+package analytics
+
+import (
+	"context"
+
+	"github.com/dikaeinstein/ghanalytics/aggregate"
+)
+
+// topUsersPercent is the percentage of the most active users whose share of
+// the activity Summary reports.
+const topUsersPercent = 1
+
+// Summary is an overview of the events within the time window, meant as a
+// quick health check of a dataset.
+type Summary struct {
+	// Events counts the events of each type, and TotalEvents of any type.
+	Events      map[EventType]int `json:"events"`
+	TotalEvents int               `json:"totalEvents"`
+
+	// Actors, Repos and Commits count the distinct users and repositories
+	// with events, and the commits they pushed.
+	Actors  int `json:"actors"`
+	Repos   int `json:"repos"`
+	Commits int `json:"commits"`
+
+	// AvgCommitsPerPush is the number of commits pushed per push event.
+	AvgCommitsPerPush float64 `json:"avgCommitsPerPush"`
+
+	// TopUsersShare is the fraction of the events created by the 1% most
+	// active users, counting at least one user.
+	TopUsersShare float64 `json:"topUsersShare"`
+
+	// Error bounds the estimates of an approximate Summary, see
+	// Approximate. It is nil for exact ones.
+	Error *SummaryError `json:"error,omitempty"`
+}
+
+// Summary returns the event type breakdown of the events within the Since
+// and Until window, along with the distinct actors, repositories and commits
+// involved.
+func (a *Analytics) Summary(options ...func(*Analytics) error) (Summary, error) {
+	return a.SummaryContext(context.Background(), options...)
+}
+
+// SummaryContext is like Summary, aborting with the context's error once
+// ctx is done.
+func (a *Analytics) SummaryContext(ctx context.Context, options ...func(*Analytics) error) (Summary, error) {
+	call, err := a.parseListOptions(options)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	summary := Summary{Events: make(map[EventType]int)}
+	eventsByActor := make(map[uint64]int)
+	repos := make(map[uint64]bool)
+	var approx *approxSummary
+	if call.listOptions.approx {
+		approx = newApproxSummary()
+	}
+	pushes := 0
+	err = call.store.ForEachEvent(ctx, call.eventFilter(nil), func(e Event, commits int) error {
+		summary.Events[e.Type]++
+		summary.TotalEvents++
+		if approx != nil {
+			approx.add(e)
+		} else {
+			eventsByActor[e.ActorID]++
+			repos[e.RepoID] = true
+		}
+		if e.Type == PushEvent {
+			pushes++
+			summary.Commits += commits
+		}
+		return nil
+	})
+	if err != nil {
+		return Summary{}, err
+	}
+	if pushes > 0 {
+		summary.AvgCommitsPerPush = float64(summary.Commits) / float64(pushes)
+	}
+	if approx != nil {
+		approx.fill(&summary)
+		return summary, nil
+	}
+
+	summary.Actors = len(eventsByActor)
+	summary.Repos = len(repos)
+	if summary.TotalEvents > 0 {
+		counts := make([]int, 0, len(eventsByActor))
+		for _, n := range eventsByActor {
+			counts = append(counts, n)
+		}
+
+		top := (len(counts)*topUsersPercent + 99) / 100
+		topEvents := 0
+		for _, n := range aggregate.TopK(counts, top, func(a, b int) bool { return a > b }) {
+			topEvents += n
+		}
+		summary.TopUsersShare = float64(topEvents) / float64(summary.TotalEvents)
+	}
+
+	return summary, nil
+}
@@ -0,0 +1,81 @@
+package analytics_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+	"github.com/dikaeinstein/ghanalytics/data"
+)
+
+func TestSummary(t *testing.T) {
+	store, err := data.NewStore(
+		strings.NewReader("id,username\n1,alice\n2,bob\n3,carol"),
+		strings.NewReader("sha,message,event_id\na,first,1\nb,second,1\nc,third,1\nd,fourth,4"),
+		strings.NewReader(`id,type,actor_id,repo_id,created_at
+1,PushEvent,1,10,2020-01-01T15:00:00Z
+2,WatchEvent,1,10,2020-01-01T15:10:00Z
+3,ForkEvent,1,20,2020-01-01T15:20:00Z
+4,PushEvent,2,20,2020-01-01T16:00:00Z
+5,WatchEvent,3,20,2020-01-01T16:30:00Z`),
+		strings.NewReader("id,name\n10,alice/ten\n20,bob/twenty"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		desc     string
+		options  []func(*analytics.Analytics) error
+		expected analytics.Summary
+	}{
+		{
+			desc: "All events",
+			expected: analytics.Summary{
+				Events: map[analytics.EventType]int{
+					analytics.PushEvent: 2, analytics.WatchEvent: 2, analytics.ForkEvent: 1,
+				},
+				TotalEvents:       5,
+				Actors:            3,
+				Repos:             2,
+				Commits:           4,
+				AvgCommitsPerPush: 2,
+				TopUsersShare:     0.6,
+			},
+		},
+		{
+			desc:    "Within window",
+			options: []func(*analytics.Analytics) error{analytics.Since(time.Date(2020, 1, 1, 16, 0, 0, 0, time.UTC))},
+			expected: analytics.Summary{
+				Events: map[analytics.EventType]int{
+					analytics.PushEvent: 1, analytics.WatchEvent: 1,
+				},
+				TotalEvents:       2,
+				Actors:            2,
+				Repos:             1,
+				Commits:           1,
+				AvgCommitsPerPush: 1,
+				TopUsersShare:     0.5,
+			},
+		},
+		{
+			desc:     "Empty window",
+			options:  []func(*analytics.Analytics) error{analytics.Since(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))},
+			expected: analytics.Summary{Events: map[analytics.EventType]int{}},
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			summary, err := analytics.New(store).Summary(tC.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(summary, tC.expected) {
+				t.Errorf("Wrong summary returned. want %+v; got %+v", tC.expected, summary)
+			}
+		})
+	}
+}
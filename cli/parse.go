@@ -4,27 +4,171 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
 )
 
 type Config struct {
 	help bool
 
+	// format is the output format, one of the renderers keys.
+	format string
+
+	// dataDir is the directory holding the CSV files, and the paths
+	// override the location of individual files.
+	dataDir     string
+	actorsPath  string
+	commitsPath string
+	eventsPath  string
+	reposPath   string
+
+	// db is the SQLite database to import into, and query from.
+	db string
+
+	// archives are GH Archive hourly dumps to load instead of the CSV files.
+	archives pathList
+
+	// since and until bound the time window of the analyzed events.
+	since timeValue
+	until timeValue
+
+	// users and repos subcommand flags
+	limit    int
+	offset   int
+	sort     sortValue
+	weights  weightsValue
+	tieBreak string
+
+	// approx estimates the users and repos rankings, and the summary, with
+	// sketches.
+	approx bool
+
+	// bot detection flags of the users, repos, owners and bots subcommands
+	excludeBots bool
+	onlyBots    bool
+	botPatterns pathList
+
+	// serve subcommand flags
+	addr string
+
+	// timeseries subcommand flags
+	interval intervalValue
+	actorID  uint64
+	repoID   uint64
+
 	// args are the positional (non-flag) command-line arguments.
 	args []string
 }
 
-const usage = `GhAnalytics is a CLI tool which analyzes Github event data for 1 hour.
+const usage = `GhAnalytics is a CLI tool which analyzes Github event data.
 
 Usage:
-  ghanalytics [command]
+  ghanalytics [flags] [command] [command flags]
 
 Available Commands:
-  topTenUsers			Top 10 active users sorted by amount of PRs created and commits.
+  users				Active users ranked by the sort criteria.
+				Flags: -limit N (default 10, 0 for all), -offset N, -sort LIST (default commits,prs),
+				-tiebreak id|name (default id), -weights LIST, -exclude-bots, -only-bots,
+				-approx
+  repos				Repositories ranked by the sort criteria.
+				Flags: -limit N (default 10, 0 for all), -offset N, -sort LIST (default commits),
+				-tiebreak id|name (default id), -weights LIST, -exclude-bots, -only-bots,
+				-approx
+  owners			Repository owners ranked by the sort criteria summed across their repos.
+				Flags: -limit N (default 10, 0 for all), -offset N,
+				-sort LIST (default commits,pushes,prs,watches), -weights LIST,
+				-exclude-bots, -only-bots
+  top10Users			Top 10 active users sorted by amount of PRs created and commits.
   top10ReposByCommitsPushed	Top 10 repositories sorted by amount of commits pushed.
   top10ReposByWatchEvents	Top 10 repositories sorted by amount of watch events.
+  top10ReposByForks		Top 10 repositories sorted by amount of forks.
+  top10ReposByReleases		Top 10 repositories sorted by amount of releases.
+  top10UsersByIssueComments	Top 10 users sorted by amount of issue comments.
+  top10UsersByReviewComments	Top 10 users sorted by amount of pull request review comments.
+  topOwners			Top 10 repository owners by pushes, commits, PRs and watches combined.
+  timeseries			Activity per event type bucketed over time.
+				Flags: -interval minute|hour|day, -actor ID, -repo ID
+  user ID|USERNAME		Activity profile of a user: events per type, repos touched, commits,
+				sample commit messages and leaderboard positions.
+				Flags: -exclude-bots, -only-bots
+  repo ID|OWNER/NAME		Activity profile of a repository: events per type, contributors,
+				commits, sample commit messages and leaderboard positions.
+				Flags: -exclude-bots, -only-bots
+  bots				Users detected as bots, with the reasons they were.
+  summary			Event type breakdown, distinct actors, repos and commits, and share of
+				activity from the top 1% of users. Flags: -approx
+  serve				Serve the analytics as an HTTP JSON API: /users, /users/{id|name}, /repos,
+				/repos/{id|name}, /owners and /summary, taking the command flags as
+				query parameters. Flags: -addr HOST:PORT (default localhost:8080)
+  import			Import the CSV files or archives into the SQLite database given by -db.
+
+Sort Criteria:
+  commits		Commits pushed
+  pushes		Push events
+  prs			Pull request events
+  watches		Watch events (stars)
+  forks			Fork events
+  issues		Issues events
+  issuecomments		Issue comment events
+  creates		Create events (branches and tags)
+  deletes		Delete events (branches and tags)
+  releases		Release events
+  wikiedits		Gollum events (wiki edits)
+  members		Member events (collaborators added)
+  public		Public events (repositories made public)
+  commitcomments	Commit comment events
+  reviewcomments	Pull request review comment events
+Any event type name found in the data, e.g. ForkEvent or DiscussionEvent, is
+accepted too.
+
+Entries are ranked by the combined amount of the sort criteria. Ties are
+broken by each criteria in the order given, then by -tiebreak.
+
+-weights scales each criteria's contribution to the ranking, e.g.
+-weights prs=5,pushes=1,reviewcomments=2. Without -sort, entries are ranked
+by the weighted criteria only.
+
+-approx estimates the rankings and the distinct actors and repos of the
+summary with Space-Saving, Count-Min and HyperLogLog sketches, keeping memory
+fixed however many events are analyzed. Results come with their error bounds.
+Rankings cannot combine it with -exclude-bots or -only-bots, as detecting bots
+holds every user's pushes in memory.
+
+Bots are detected by a "[bot]" username suffix, usernames matching a
+-bot-pattern regular expression (default "(?i)[-_.]bot$" and "[a-z0-9]Bot$";
+may be repeated), an abnormally regular push cadence, or commit messages
+following a template.
 
 Flags:
-  -h, -help	Show help`
+  -data-dir	Directory holding actors.csv, commits.csv, events.csv and repos.csv
+		(default $GHANALYTICS_DATA_DIR or ./data)
+  -actors, -commits, -events, -repos
+		Path of an individual CSV file, overriding -data-dir
+  -db		Query the SQLite database at this path, created by the import command
+  -archive	Load a GH Archive hourly dump (.json.gz) instead of the CSV files; may be repeated
+  -since	Only analyze events created at or after this time (RFC 3339 or YYYY-MM-DD)
+  -until	Only analyze events created before this time (RFC 3339 or YYYY-MM-DD)
+  -format	Output format: table, json, ndjson, csv or markdown (default table)
+  -h, -help	Show help
+
+Flags may also be given after the command.`
+
+// aliases expand the top10* and topOwners subcommands into the equivalent
+// users, repos and owners invocations.
+var aliases = map[string][]string{
+	"top10Users":                 {"users", "-limit", "10", "-sort", "commits,prs"},
+	"top10ReposByCommitsPushed":  {"repos", "-limit", "10", "-sort", "commits"},
+	"top10ReposByWatchEvents":    {"repos", "-limit", "10", "-sort", "watches"},
+	"top10ReposByForks":          {"repos", "-limit", "10", "-sort", "forks"},
+	"top10ReposByReleases":       {"repos", "-limit", "10", "-sort", "releases"},
+	"top10UsersByIssueComments":  {"users", "-limit", "10", "-sort", "issuecomments"},
+	"top10UsersByReviewComments": {"users", "-limit", "10", "-sort", "reviewcomments"},
+	"topOwners":                  {"owners", "-limit", "10"},
+}
 
 // ParseFlags parses the command-line arguments provided to the program.
 // Typically os.Args[0] is provided as 'progname' and os.args[1:] as 'args'.
@@ -41,8 +185,7 @@ func parseArgs(progname string, args []string) (config *Config, output string, e
 	}
 
 	var conf Config
-	flags.BoolVar(&conf.help, "help", false, "Show help")
-	flags.BoolVar(&conf.help, "h", false, "Show help")
+	commonFlags(flags, &conf)
 
 	err = flags.Parse(args)
 	if err != nil {
@@ -50,5 +193,293 @@ func parseArgs(progname string, args []string) (config *Config, output string, e
 	}
 
 	conf.args = flags.Args()
+
+	if len(conf.args) > 0 {
+		if expanded, ok := aliases[conf.args[0]]; ok {
+			conf.args = append(append([]string{}, expanded...), conf.args[1:]...)
+		}
+	}
+
+	if len(conf.args) > 0 {
+		subFlags := subcommandFlags(conf.args[0], &conf)
+		if subFlags != nil {
+			subFlags.SetOutput(&buf)
+			subFlags.Usage = flags.Usage
+			// flags may follow positional arguments, as in "repo NAME -format json"
+			rest := conf.args[1:]
+			var positional []string
+			for {
+				err = subFlags.Parse(rest)
+				if err != nil {
+					return nil, buf.String(), err
+				}
+				rest = subFlags.Args()
+				if len(rest) == 0 {
+					break
+				}
+				positional = append(positional, rest[0])
+				rest = rest[1:]
+			}
+			conf.args = append(conf.args[:1], positional...)
+
+			if conf.excludeBots && conf.onlyBots {
+				return nil, buf.String(), fmt.Errorf("-exclude-bots and -only-bots are mutually exclusive")
+			}
+
+			// weights replace the default sort criteria unless -sort is given
+			sortSet := false
+			subFlags.Visit(func(f *flag.Flag) {
+				sortSet = sortSet || f.Name == "sort"
+			})
+			if conf.weights != nil && !sortSet {
+				conf.sort = nil
+			}
+		}
+	}
+
 	return &conf, buf.String(), nil
 }
+
+// commonFlags registers the flags accepted both before and after the
+// subcommand.
+func commonFlags(flags *flag.FlagSet, conf *Config) {
+	flags.BoolVar(&conf.help, "help", conf.help, "Show help")
+	flags.BoolVar(&conf.help, "h", conf.help, "Show help")
+	flags.StringVar(&conf.format, "format", conf.format, "Output format")
+	flags.StringVar(&conf.dataDir, "data-dir", conf.dataDir, "Directory holding the CSV files")
+	flags.StringVar(&conf.actorsPath, "actors", conf.actorsPath, "Path of the actors CSV file")
+	flags.StringVar(&conf.commitsPath, "commits", conf.commitsPath, "Path of the commits CSV file")
+	flags.StringVar(&conf.eventsPath, "events", conf.eventsPath, "Path of the events CSV file")
+	flags.StringVar(&conf.reposPath, "repos", conf.reposPath, "Path of the repos CSV file")
+	flags.StringVar(&conf.db, "db", conf.db, "Path of the SQLite database")
+	flags.Var(&conf.archives, "archive", "Load a GH Archive hourly dump")
+	flags.Var(&conf.since, "since", "Only analyze events created at or after this time")
+	flags.Var(&conf.until, "until", "Only analyze events created before this time")
+}
+
+// subcommandFlags returns the flag set of the subcommand name, storing the
+// parsed values in conf. It returns nil for unknown subcommands.
+func subcommandFlags(name string, conf *Config) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	commonFlags(flags, conf)
+
+	switch name {
+	case "users":
+		conf.sort = sortValue{analytics.CommitsPushed, analytics.PrCreated}
+		flags.IntVar(&conf.limit, "limit", 10, "Number of users to list")
+		flags.IntVar(&conf.offset, "offset", 0, "Number of users to skip")
+		flags.Var(&conf.sort, "sort", "Comma separated sort criteria")
+		flags.Var(&conf.weights, "weights", "Comma separated criteria=weight pairs")
+		flags.StringVar(&conf.tieBreak, "tiebreak", "", "Final key ordering ties: id or name")
+		approxFlag(flags, conf)
+		botFlags(flags, conf)
+	case "repos":
+		conf.sort = sortValue{analytics.CommitsPushed}
+		flags.IntVar(&conf.limit, "limit", 10, "Number of repositories to list")
+		flags.IntVar(&conf.offset, "offset", 0, "Number of repositories to skip")
+		flags.Var(&conf.sort, "sort", "Comma separated sort criteria")
+		flags.Var(&conf.weights, "weights", "Comma separated criteria=weight pairs")
+		flags.StringVar(&conf.tieBreak, "tiebreak", "", "Final key ordering ties: id or name")
+		approxFlag(flags, conf)
+		botFlags(flags, conf)
+	case "owners":
+		conf.sort = sortValue{analytics.CommitsPushed, analytics.Pushes, analytics.PrCreated, analytics.Watches}
+		flags.IntVar(&conf.limit, "limit", 10, "Number of owners to list")
+		flags.IntVar(&conf.offset, "offset", 0, "Number of owners to skip")
+		flags.Var(&conf.sort, "sort", "Comma separated sort criteria")
+		flags.Var(&conf.weights, "weights", "Comma separated criteria=weight pairs")
+		botFlags(flags, conf)
+	case "user", "repo":
+		botFlags(flags, conf)
+	case "bots":
+		flags.Var(&conf.botPatterns, "bot-pattern", "Username regular expression detecting bots")
+	case "serve":
+		flags.StringVar(&conf.addr, "addr", defaultAddr, "Address to listen on")
+	case "summary":
+		approxFlag(flags, conf)
+	case "import":
+	case "timeseries":
+		flags.Var(&conf.interval, "interval", "Bucket width: minute, hour, day or a duration")
+		flags.Uint64Var(&conf.actorID, "actor", 0, "Only count events of this user ID")
+		flags.Uint64Var(&conf.repoID, "repo", 0, "Only count events of this repository ID")
+	default:
+		return nil
+	}
+
+	return flags
+}
+
+// approxFlag registers the flag estimating results with sketches.
+func approxFlag(flags *flag.FlagSet, conf *Config) {
+	flags.BoolVar(&conf.approx, "approx", false, "Estimate with fixed memory sketches, reporting error bounds")
+}
+
+// botFlags registers the flags filtering bots out of, or into, the rankings.
+func botFlags(flags *flag.FlagSet, conf *Config) {
+	flags.BoolVar(&conf.excludeBots, "exclude-bots", false, "Leave out the events of detected bots")
+	flags.BoolVar(&conf.onlyBots, "only-bots", false, "Only rank the events of detected bots")
+	flags.Var(&conf.botPatterns, "bot-pattern", "Username regular expression detecting bots")
+}
+
+// pathList is a flag.Value collecting the values of a repeatable flag.
+type pathList []string
+
+func (p *pathList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *pathList) Set(path string) error {
+	*p = append(*p, path)
+	return nil
+}
+
+// timeValue is a flag.Value parsing an RFC 3339 timestamp or a date.
+type timeValue struct {
+	time.Time
+}
+
+func (t *timeValue) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func (t *timeValue) Set(value string) error {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		parsed, err := time.Parse(layout, value)
+		if err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid time %q, expected RFC 3339 or YYYY-MM-DD", value)
+}
+
+// sortCriteriaNames maps the names accepted by -sort to their criteria.
+var sortCriteriaNames = map[string]analytics.SortCriteria{
+	"commits":        analytics.CommitsPushed,
+	"pushes":         analytics.Pushes,
+	"prs":            analytics.PrCreated,
+	"watches":        analytics.Watches,
+	"forks":          analytics.Forks,
+	"issues":         analytics.Issues,
+	"issuecomments":  analytics.IssueComments,
+	"creates":        analytics.Creates,
+	"deletes":        analytics.Deletes,
+	"releases":       analytics.Releases,
+	"wikiedits":      analytics.WikiEdits,
+	"members":        analytics.MembersAdded,
+	"public":         analytics.MadePublic,
+	"commitcomments": analytics.CommitComments,
+	"reviewcomments": analytics.ReviewComments,
+}
+
+// parseCriteria returns the criteria named by one of sortCriteriaNames, or by
+// an event type.
+func parseCriteria(name string) (analytics.SortCriteria, bool) {
+	if c, ok := sortCriteriaNames[name]; ok {
+		return c, true
+	}
+	if _, err := analytics.SortCriteria(name).EventType(); err == nil {
+		return analytics.SortCriteria(name), true
+	}
+	return "", false
+}
+
+// sortValue is a flag.Value parsing a comma separated list of sort criteria.
+// Setting it replaces the subcommand's default criteria.
+type sortValue []analytics.SortCriteria
+
+func (s *sortValue) String() string {
+	names := make([]string, len(*s))
+	for i, c := range *s {
+		names[i] = string(c)
+		for name, criteria := range sortCriteriaNames {
+			if criteria == c {
+				names[i] = name
+			}
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func (s *sortValue) Set(value string) error {
+	var criterion []analytics.SortCriteria
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		c, ok := parseCriteria(name)
+		if !ok {
+			return fmt.Errorf("unknown sort criteria %q", name)
+		}
+		criterion = append(criterion, c)
+	}
+	*s = criterion
+	return nil
+}
+
+// weightsValue is a flag.Value parsing a comma separated list of
+// criteria=weight pairs.
+type weightsValue map[analytics.SortCriteria]int
+
+func (w *weightsValue) String() string {
+	pairs := make([]string, 0, len(*w))
+	for c, weight := range *w {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", c, weight))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (w *weightsValue) Set(value string) error {
+	weights := make(weightsValue)
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid weight %q, expected criteria=weight", pair)
+		}
+		name, weight := parts[0], parts[1]
+		c, ok := parseCriteria(name)
+		if !ok {
+			return fmt.Errorf("unknown weight criteria %q", name)
+		}
+		n, err := strconv.Atoi(weight)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid weight %q for %s, expected a non-negative integer", weight, name)
+		}
+		weights[c] = n
+	}
+	*w = weights
+	return nil
+}
+
+// intervalValue is a flag.Value parsing a bucket width given by name
+// or as a duration.
+type intervalValue struct {
+	time.Duration
+}
+
+func (i *intervalValue) String() string {
+	if i.Duration == 0 {
+		return ""
+	}
+	return i.Duration.String()
+}
+
+func (i *intervalValue) Set(value string) error {
+	switch value {
+	case "minute":
+		i.Duration = analytics.Minute
+	case "hour":
+		i.Duration = analytics.Hour
+	case "day":
+		i.Duration = analytics.Day
+	default:
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid interval %q, expected minute, hour, day or a duration", value)
+		}
+		i.Duration = d
+	}
+	return nil
+}
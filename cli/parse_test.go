@@ -4,6 +4,9 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
 )
 
 func TestParseFlagsCorrect(t *testing.T) {
@@ -31,3 +34,222 @@ func TestParseFlagsCorrect(t *testing.T) {
 		})
 	}
 }
+
+func TestParseFlagsArchive(t *testing.T) {
+	args := []string{"-archive", "2020-01-01-15.json.gz", "-archive", "2020-01-01-16.json.gz", "top10Users"}
+	conf, _, err := parseArgs("prog", args)
+	if err != nil {
+		t.Fatalf("err got %v, want nil", err)
+	}
+
+	want := Config{
+		archives: pathList{"2020-01-01-15.json.gz", "2020-01-01-16.json.gz"},
+		limit:    10,
+		sort:     sortValue{analytics.CommitsPushed, analytics.PrCreated},
+		args:     []string{"users"},
+	}
+	if !reflect.DeepEqual(*conf, want) {
+		t.Errorf("conf got %+v, want %+v", *conf, want)
+	}
+}
+
+func TestParseFlagsHelp(t *testing.T) {
+	for _, args := range [][]string{
+		{"-help", "users"},
+		{"-h", "repo", "bob/site"},
+		{"users", "-help"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			conf, _, err := parseArgs("prog", args)
+			if err != nil {
+				t.Fatalf("err got %v, want nil", err)
+			}
+			if !conf.help {
+				t.Error("help got false, want true")
+			}
+		})
+	}
+}
+
+func TestParseFlagsWindow(t *testing.T) {
+	args := []string{"-since", "2020-01-01", "-until", "2020-01-01T16:00:00Z", "top10Users"}
+	conf, _, err := parseArgs("prog", args)
+	if err != nil {
+		t.Fatalf("err got %v, want nil", err)
+	}
+
+	since := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !conf.since.Equal(since) {
+		t.Errorf("since got %v, want %v", conf.since, since)
+	}
+	until := time.Date(2020, 1, 1, 16, 0, 0, 0, time.UTC)
+	if !conf.until.Equal(until) {
+		t.Errorf("until got %v, want %v", conf.until, until)
+	}
+}
+
+func TestParseFlagsInvalidTime(t *testing.T) {
+	_, _, err := parseArgs("prog", []string{"-since", "yesterday", "top10Users"})
+	if err == nil {
+		t.Error("err got nil, want invalid time error")
+	}
+}
+
+func TestParseFlagsTimeseries(t *testing.T) {
+	args := []string{"-since", "2020-01-01", "timeseries", "-interval", "minute", "-repo", "42"}
+	conf, _, err := parseArgs("prog", args)
+	if err != nil {
+		t.Fatalf("err got %v, want nil", err)
+	}
+
+	if conf.interval.Duration != time.Minute {
+		t.Errorf("interval got %v, want %v", conf.interval, time.Minute)
+	}
+	if conf.repoID != 42 {
+		t.Errorf("repoID got %v, want 42", conf.repoID)
+	}
+	if !reflect.DeepEqual(conf.args, []string{"timeseries"}) {
+		t.Errorf("args got %v, want [timeseries]", conf.args)
+	}
+}
+
+func TestParseFlagsRanking(t *testing.T) {
+	var tests = []struct {
+		args []string
+		conf Config
+	}{
+		{
+			[]string{"users"},
+			Config{limit: 10, sort: sortValue{analytics.CommitsPushed, analytics.PrCreated}, args: []string{"users"}},
+		},
+		{
+			[]string{"repos", "-limit", "50", "-sort", "prs,watches", "-format", "json"},
+			Config{format: "json", limit: 50, sort: sortValue{analytics.PrCreated, analytics.Watches}, args: []string{"repos"}},
+		},
+		{
+			[]string{"-format", "csv", "top10ReposByWatchEvents"},
+			Config{format: "csv", limit: 10, sort: sortValue{analytics.Watches}, args: []string{"repos"}},
+		},
+		{
+			[]string{"users", "-limit", "0", "-offset", "20"},
+			Config{limit: 0, offset: 20, sort: sortValue{analytics.CommitsPushed, analytics.PrCreated}, args: []string{"users"}},
+		},
+		{
+			[]string{"top10ReposByCommitsPushed", "-limit", "3"},
+			Config{limit: 3, sort: sortValue{analytics.CommitsPushed}, args: []string{"repos"}},
+		},
+		{
+			[]string{"top10ReposByForks"},
+			Config{limit: 10, sort: sortValue{analytics.Forks}, args: []string{"repos"}},
+		},
+		{
+			[]string{"top10UsersByIssueComments"},
+			Config{limit: 10, sort: sortValue{analytics.IssueComments}, args: []string{"users"}},
+		},
+		{
+			[]string{"topOwners", "-offset", "10"},
+			Config{limit: 10, offset: 10, sort: sortValue{analytics.CommitsPushed, analytics.Pushes, analytics.PrCreated, analytics.Watches}, args: []string{"owners"}},
+		},
+		{
+			[]string{"users", "--exclude-bots", "-bot-pattern", "^ci-", "-bot-pattern", "-robot$"},
+			Config{limit: 10, sort: sortValue{analytics.CommitsPushed, analytics.PrCreated}, excludeBots: true, botPatterns: pathList{"^ci-", "-robot$"}, args: []string{"users"}},
+		},
+		{
+			[]string{"top10ReposByCommitsPushed", "--only-bots"},
+			Config{limit: 10, sort: sortValue{analytics.CommitsPushed}, onlyBots: true, args: []string{"repos"}},
+		},
+		{
+			[]string{"repos", "-sort", "ReleaseEvent,wikiedits"},
+			Config{limit: 10, sort: sortValue{analytics.Releases, analytics.WikiEdits}, args: []string{"repos"}},
+		},
+		{
+			[]string{"users", "-weights", "prs=5,pushes=1,PullRequestReviewCommentEvent=2"},
+			Config{limit: 10, weights: weightsValue{
+				analytics.PrCreated:      5,
+				analytics.Pushes:         1,
+				analytics.ReviewComments: 2,
+			}, args: []string{"users"}},
+		},
+		{
+			[]string{"repos", "-sort", "commits", "-weights", "commits=3"},
+			Config{limit: 10, sort: sortValue{analytics.CommitsPushed}, weights: weightsValue{analytics.CommitsPushed: 3}, args: []string{"repos"}},
+		},
+		{
+			[]string{"top10Users", "--approx"},
+			Config{limit: 10, sort: sortValue{analytics.CommitsPushed, analytics.PrCreated}, approx: true, args: []string{"users"}},
+		},
+		{
+			[]string{"summary", "-approx"},
+			Config{approx: true, args: []string{"summary"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			conf, _, err := parseArgs("prog", tt.args)
+			if err != nil {
+				t.Fatalf("err got %v, want nil", err)
+			}
+			if !reflect.DeepEqual(*conf, tt.conf) {
+				t.Errorf("conf got %+v, want %+v", *conf, tt.conf)
+			}
+		})
+	}
+}
+
+func TestParseFlagsApproxOwners(t *testing.T) {
+	_, _, err := parseArgs("prog", []string{"owners", "-approx"})
+	if err == nil {
+		t.Error("err got nil, want undefined flag error")
+	}
+}
+
+func TestParseFlagsUnknownSortCriteria(t *testing.T) {
+	_, _, err := parseArgs("prog", []string{"users", "-sort", "commits,stars"})
+	if err == nil {
+		t.Error("err got nil, want unknown sort criteria error")
+	}
+}
+
+func TestParseFlagsInvalidWeights(t *testing.T) {
+	for _, weights := range []string{"prs", "prs=-1", "prs=many", "stars=2"} {
+		_, _, err := parseArgs("prog", []string{"users", "-weights", weights})
+		if err == nil {
+			t.Errorf("err got nil for %q, want invalid weights error", weights)
+		}
+	}
+}
+
+func TestParseFlagsBotFiltersExclusive(t *testing.T) {
+	_, _, err := parseArgs("prog", []string{"users", "-exclude-bots", "-only-bots"})
+	if err == nil {
+		t.Error("err got nil, want mutually exclusive bot filters error")
+	}
+}
+
+func TestParseFlagsProfile(t *testing.T) {
+	conf, _, err := parseArgs("prog", []string{"repo", "team/app", "-format", "json", "-exclude-bots"})
+	if err != nil {
+		t.Fatalf("err got %v, want nil", err)
+	}
+
+	want := Config{format: "json", excludeBots: true, args: []string{"repo", "team/app"}}
+	if !reflect.DeepEqual(*conf, want) {
+		t.Errorf("conf got %+v, want %+v", *conf, want)
+	}
+}
+
+func TestParseFlagsDataFiles(t *testing.T) {
+	args := []string{"-data-dir", "/tmp/gh", "users", "-events", "/tmp/events.csv"}
+	conf, _, err := parseArgs("prog", args)
+	if err != nil {
+		t.Fatalf("err got %v, want nil", err)
+	}
+
+	if conf.dataDir != "/tmp/gh" {
+		t.Errorf("dataDir got %q, want %q", conf.dataDir, "/tmp/gh")
+	}
+	if conf.eventsPath != "/tmp/events.csv" {
+		t.Errorf("eventsPath got %q, want %q", conf.eventsPath, "/tmp/events.csv")
+	}
+}
@@ -0,0 +1,350 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+)
+
+// report is the result of a subcommand in a shape every renderer can
+// consume: rows of formatted cells for the tabular formats, and the
+// underlying records for the structured ones.
+type report struct {
+	columns []string
+	rows    [][]string
+	records []interface{}
+}
+
+// renderFunc writes a report to w in a given output format.
+type renderFunc func(w io.Writer, r *report) error
+
+// renderers maps the values accepted by -format to their renderFunc.
+var renderers = map[string]renderFunc{
+	"table":    renderTable,
+	"json":     renderJSON,
+	"ndjson":   renderNDJSON,
+	"csv":      renderCSV,
+	"markdown": renderMarkdown,
+}
+
+// rendererFor returns the renderFunc of format, defaulting to table.
+func rendererFor(format string) (renderFunc, error) {
+	if format == "" {
+		format = "table"
+	}
+
+	render, ok := renderers[format]
+	if !ok {
+		names := make([]string, 0, len(renderers))
+		for name := range renderers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown format %q, expected one of: %s",
+			format, strings.Join(names, ", "))
+	}
+
+	return render, nil
+}
+
+func renderTable(w io.Writer, r *report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', tabwriter.Debug)
+	fmt.Fprintln(tw, strings.Join(r.columns, "\t")+"\t")
+	fmt.Fprintln(tw, strings.Repeat("-\t", len(r.columns)))
+	for _, row := range r.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+	}
+	return tw.Flush()
+}
+
+func renderJSON(w io.Writer, r *report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	records := r.records
+	if records == nil {
+		records = []interface{}{}
+	}
+	return enc.Encode(records)
+}
+
+func renderNDJSON(w io.Writer, r *report) error {
+	enc := json.NewEncoder(w)
+	for _, record := range r.records {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderCSV(w io.Writer, r *report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(r.columns); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(r.rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func renderMarkdown(w io.Writer, r *report) error {
+	escape := strings.NewReplacer("|", `\|`, "\n", " ")
+
+	cells := func(row []string) string {
+		escaped := make([]string, len(row))
+		for i, cell := range row {
+			escaped[i] = escape.Replace(cell)
+		}
+		return "| " + strings.Join(escaped, " | ") + " |"
+	}
+
+	if _, err := fmt.Fprintln(w, cells(r.columns)); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, "|"+strings.Repeat(" --- |", len(r.columns))); err != nil {
+		return err
+	}
+	for _, row := range r.rows {
+		if _, err := fmt.Fprintln(w, cells(row)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func usersReport(users []analytics.UserResult) *report {
+	r := &report{
+		columns: []string{"ID", "Username", "Commits", "Pushes", "PRs", "Watches", "Total"},
+	}
+	if len(users) > 0 && users[0].Stats.Error != nil {
+		r.columns = append(r.columns, "Total error")
+	}
+	for _, u := range users {
+		r.rows = append(r.rows, append([]string{
+			strconv.FormatUint(u.ID, 10), u.Username,
+		}, statsCells(u.Stats)...))
+		r.records = append(r.records, u)
+	}
+	return r
+}
+
+func reposReport(repos []analytics.RepoResult) *report {
+	r := &report{
+		columns: []string{"ID", "Name", "Commits", "Pushes", "PRs", "Watches", "Total"},
+	}
+	if len(repos) > 0 && repos[0].Stats.Error != nil {
+		r.columns = append(r.columns, "Total error")
+	}
+	for _, repo := range repos {
+		r.rows = append(r.rows, append([]string{
+			strconv.FormatUint(repo.ID, 10), repo.Name,
+		}, statsCells(repo.Stats)...))
+		r.records = append(r.records, repo)
+	}
+	return r
+}
+
+func ownersReport(owners []analytics.OwnerResult) *report {
+	r := &report{
+		columns: []string{"Owner", "Repos", "Commits", "Pushes", "PRs", "Watches", "Total"},
+	}
+	for _, o := range owners {
+		r.rows = append(r.rows, append([]string{
+			o.Owner, strconv.Itoa(o.Repos),
+		}, statsCells(o.Stats)...))
+		r.records = append(r.records, o)
+	}
+	return r
+}
+
+func botsReport(bots []analytics.Bot) *report {
+	r := &report{columns: []string{"ID", "Username", "Reasons"}}
+	for _, b := range bots {
+		r.rows = append(r.rows, []string{
+			strconv.FormatUint(b.ID, 10), b.Username, strings.Join(b.Reasons, ", "),
+		})
+		r.records = append(r.records, b)
+	}
+	return r
+}
+
+// statsCells returns the cells of s, ending with the error of its Total for
+// approximate rankings: at most that much above the exact one.
+func statsCells(s analytics.Stats) []string {
+	cells := []string{
+		strconv.Itoa(s.Commits),
+		strconv.Itoa(s.Pushes),
+		strconv.Itoa(s.PullRequests),
+		strconv.Itoa(s.Watches),
+		strconv.Itoa(s.Total),
+	}
+	if s.Error != nil {
+		cells = append(cells, "+"+strconv.Itoa(s.Error.Total))
+	}
+	return cells
+}
+
+func seriesReport(series []analytics.Bucket) *report {
+	// One column per event type seen anywhere in the series
+	seen := make(map[analytics.EventType]bool)
+	var eventTypes []analytics.EventType
+	for _, b := range series {
+		for t := range b.Counts {
+			if !seen[t] {
+				seen[t] = true
+				eventTypes = append(eventTypes, t)
+			}
+		}
+	}
+	sort.Slice(eventTypes, func(i, j int) bool { return eventTypes[i] < eventTypes[j] })
+
+	r := &report{columns: []string{"Start"}}
+	for _, t := range eventTypes {
+		r.columns = append(r.columns, string(t))
+	}
+	r.columns = append(r.columns, "Total")
+
+	for _, b := range series {
+		row := []string{b.Start.Format(time.RFC3339)}
+		for _, t := range eventTypes {
+			row = append(row, strconv.Itoa(b.Counts[t]))
+		}
+		row = append(row, strconv.Itoa(b.Total()))
+		r.rows = append(r.rows, row)
+		r.records = append(r.records, b)
+	}
+	return r
+}
+
+func summaryReport(summary analytics.Summary) *report {
+	r := &report{
+		columns: []string{"Metric", "Value"},
+		records: []interface{}{summary},
+	}
+
+	eventTypes := make([]analytics.EventType, 0, len(summary.Events))
+	for t := range summary.Events {
+		eventTypes = append(eventTypes, t)
+	}
+	sort.Slice(eventTypes, func(i, j int) bool {
+		if summary.Events[eventTypes[i]] != summary.Events[eventTypes[j]] {
+			return summary.Events[eventTypes[i]] > summary.Events[eventTypes[j]]
+		}
+		return eventTypes[i] < eventTypes[j]
+	})
+	for _, t := range eventTypes {
+		r.rows = append(r.rows, []string{string(t), strconv.Itoa(summary.Events[t])})
+	}
+
+	actors := strconv.Itoa(summary.Actors)
+	repos := strconv.Itoa(summary.Repos)
+	topShare := strconv.FormatFloat(summary.TopUsersShare*100, 'f', 1, 64) + "%"
+	if e := summary.Error; e != nil {
+		actors += " (±" + strconv.Itoa(e.Actors) + ")"
+		repos += " (±" + strconv.Itoa(e.Repos) + ")"
+		topShare += " (±" + strconv.FormatFloat(e.TopUsersShare*100, 'f', 1, 64) + ")"
+	}
+
+	r.rows = append(r.rows,
+		[]string{"Total events", strconv.Itoa(summary.TotalEvents)},
+		[]string{"Distinct actors", actors},
+		[]string{"Distinct repos", repos},
+		[]string{"Distinct commits", strconv.Itoa(summary.Commits)},
+		[]string{"Avg commits per push", strconv.FormatFloat(summary.AvgCommitsPerPush, 'f', 2, 64)},
+		[]string{"Top 1% users share", topShare},
+	)
+	return r
+}
+
+// maxProfileEntries bounds the repositories or contributors listed in the
+// tabular profile reports, the structured ones listing them all.
+const maxProfileEntries = 10
+
+func userProfileReport(p analytics.UserProfile) *report {
+	r := &report{
+		columns: []string{"Field", "Value"},
+		records: []interface{}{p},
+	}
+
+	r.rows = append(r.rows,
+		[]string{"ID", strconv.FormatUint(p.ID, 10)},
+		[]string{"Username", p.Username},
+	)
+	r.rows = append(r.rows, profileRows(p.Events, p.Commits, p.SampleCommitMessages, p.Ranks)...)
+
+	r.rows = append(r.rows, []string{"Repos touched", strconv.Itoa(len(p.Repos))})
+	for i, repo := range p.Repos {
+		if i == maxProfileEntries {
+			r.rows = append(r.rows, []string{"", fmt.Sprintf("... %d more", len(p.Repos)-i)})
+			break
+		}
+		r.rows = append(r.rows, []string{"", repo.Name})
+	}
+	return r
+}
+
+func repoProfileReport(p analytics.RepoProfile) *report {
+	r := &report{
+		columns: []string{"Field", "Value"},
+		records: []interface{}{p},
+	}
+
+	r.rows = append(r.rows,
+		[]string{"ID", strconv.FormatUint(p.ID, 10)},
+		[]string{"Name", p.Name},
+	)
+	r.rows = append(r.rows, profileRows(p.Events, p.Commits, p.SampleCommitMessages, p.Ranks)...)
+
+	r.rows = append(r.rows, []string{"Contributors", strconv.Itoa(len(p.Contributors))})
+	for i, u := range p.Contributors {
+		if i == maxProfileEntries {
+			r.rows = append(r.rows, []string{"", fmt.Sprintf("... %d more", len(p.Contributors)-i)})
+			break
+		}
+		r.rows = append(r.rows, []string{"", u.Username})
+	}
+	return r
+}
+
+// profileRows returns the rows common to the user and repository profiles.
+func profileRows(events map[analytics.EventType]int, commits int, messages []string, ranks []analytics.Rank) [][]string {
+	eventTypes := make([]analytics.EventType, 0, len(events))
+	for t := range events {
+		eventTypes = append(eventTypes, t)
+	}
+	sort.Slice(eventTypes, func(i, j int) bool { return eventTypes[i] < eventTypes[j] })
+
+	var rows [][]string
+	for _, t := range eventTypes {
+		rows = append(rows, []string{string(t), strconv.Itoa(events[t])})
+	}
+	rows = append(rows, []string{"Commits", strconv.Itoa(commits)})
+
+	for i, m := range messages {
+		field := ""
+		if i == 0 {
+			field = "Sample commits"
+		}
+		if j := strings.IndexByte(m, '\n'); j >= 0 {
+			m = m[:j]
+		}
+		rows = append(rows, []string{field, m})
+	}
+
+	for _, rank := range ranks {
+		rows = append(rows, []string{
+			"Rank by " + string(rank.Criteria),
+			fmt.Sprintf("#%d of %d (%d)", rank.Position, rank.Entries, rank.Value),
+		})
+	}
+	return rows
+}
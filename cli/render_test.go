@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+)
+
+func TestRenderers(t *testing.T) {
+	repos := []analytics.RepoResult{
+		{Repo: analytics.Repo{ID: 42018768, Name: "Lombiq/Helpful-Libraries"}, Stats: analytics.Stats{Commits: 3, Pushes: 2, Total: 3}},
+		{Repo: analytics.Repo{ID: 45993266, Name: "patsonluk/air|line"}, Stats: analytics.Stats{Watches: 1, Total: 1}},
+	}
+
+	testCases := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: "table",
+			expected: `ID         |Name                       |Commits   |Pushes   |PRs   |Watches   |Total   |
+-          |-                          |-         |-        |-     |-         |-       |
+42018768   |Lombiq/Helpful-Libraries   |3         |2        |0     |0         |3       |
+45993266   |patsonluk/air|line         |0         |0        |0     |1         |1       |
+`,
+		},
+		{
+			format: "csv",
+			expected: `ID,Name,Commits,Pushes,PRs,Watches,Total
+42018768,Lombiq/Helpful-Libraries,3,2,0,0,3
+45993266,patsonluk/air|line,0,0,0,1,1
+`,
+		},
+		{
+			format: "markdown",
+			expected: `| ID | Name | Commits | Pushes | PRs | Watches | Total |
+| --- | --- | --- | --- | --- | --- | --- |
+| 42018768 | Lombiq/Helpful-Libraries | 3 | 2 | 0 | 0 | 3 |
+| 45993266 | patsonluk/air\|line | 0 | 0 | 0 | 1 | 1 |
+`,
+		},
+		{
+			format: "ndjson",
+			expected: `{"id":42018768,"name":"Lombiq/Helpful-Libraries","stats":{"commits":3,"pushes":2,"pullRequests":0,"watches":0,"total":3}}
+{"id":45993266,"name":"patsonluk/air|line","stats":{"commits":0,"pushes":0,"pullRequests":0,"watches":1,"total":1}}
+`,
+		},
+		{
+			format:   "json",
+			expected: "[]\n",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.format, func(t *testing.T) {
+			render, err := rendererFor(tC.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := reposReport(repos)
+			if tC.format == "json" {
+				r = reposReport(nil)
+			}
+
+			var buf bytes.Buffer
+			if err := render(&buf, r); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tC.expected {
+				t.Errorf("output got\n%s\nwant\n%s", buf.String(), tC.expected)
+			}
+		})
+	}
+}
+
+func TestRendererForUnknownFormat(t *testing.T) {
+	if _, err := rendererFor("xml"); err == nil {
+		t.Error("err got nil, want unknown format error")
+	}
+}
+
+// failingWriter fails every write, as a closed pipe does.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestRenderWriteError(t *testing.T) {
+	for _, format := range []string{"table", "csv", "markdown"} {
+		t.Run(format, func(t *testing.T) {
+			render, err := rendererFor(format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := render(failingWriter{}, reposReport(nil)); err == nil {
+				t.Error("err got nil, want write error")
+			}
+		})
+	}
+}
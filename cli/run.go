@@ -1,10 +1,14 @@
 package cli
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"text/tabwriter"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 
 	"github.com/dikaeinstein/ghanalytics/analytics"
 	"github.com/dikaeinstein/ghanalytics/data"
@@ -26,7 +30,16 @@ func Run() int {
 		return 0
 	}
 
-	if err := run(conf); err != nil {
+	// Ctrl-C cancels the work in flight; a second one kills the program as
+	// usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := run(ctx, conf); err != nil {
 		fmt.Println(err)
 		return 1
 	}
@@ -34,98 +47,329 @@ func Run() int {
 	return 0
 }
 
-func run(conf *Config) error {
-	actorsCSVFile, err := os.Open("data/actors.csv")
+func run(ctx context.Context, conf *Config) error {
+	render, err := rendererFor(conf.format)
 	if err != nil {
 		return err
 	}
-	commitsCSVFile, err := os.Open("data/commits.csv")
+
+	if conf.args[0] == "import" {
+		r, err := handleImport(ctx, conf)
+		if err != nil {
+			return err
+		}
+		return render(os.Stdout, r)
+	}
+
+	store, err := openStore(conf)
 	if err != nil {
 		return err
 	}
-	eventsCSVFile, err := os.Open("data/events.csv")
+	if c, ok := store.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	if conf.args[0] == "serve" {
+		return serve(ctx, store, conf.addr)
+	}
+
+	an := analytics.New(store)
+
+	var r *report
+	switch conf.args[0] {
+	case "users":
+		r, err = handleUsers(ctx, an, conf)
+	case "repos":
+		r, err = handleRepos(ctx, an, conf)
+	case "owners":
+		r, err = handleOwners(ctx, an, conf)
+	case "timeseries":
+		r, err = handleTimeseries(ctx, an, conf)
+	case "summary":
+		r, err = handleSummary(ctx, an, conf)
+	case "user":
+		r, err = handleUserProfile(ctx, an, conf)
+	case "repo":
+		r, err = handleRepoProfile(ctx, an, conf)
+	case "bots":
+		r, err = handleBots(ctx, an, conf)
+	default:
+		return fmt.Errorf("unknown subcommand: %s", conf.args[0])
+	}
 	if err != nil {
 		return err
 	}
-	reposCSVFile, err := os.Open("data/repos.csv")
+
+	return render(os.Stdout, r)
+}
+
+// envDataDir names the environment variable overriding the default data
+// directory.
+const envDataDir = "GHANALYTICS_DATA_DIR"
+
+// defaultDataDir is the data directory used when neither -data-dir nor
+// GHANALYTICS_DATA_DIR are set.
+const defaultDataDir = "data"
+
+// openStore returns the store the analytics are computed from: the SQLite
+// database given by -db, or the CSV files or archives loaded in memory.
+func openStore(conf *Config) (analytics.Store, error) {
+	if conf.db == "" {
+		return loadStore(conf)
+	}
+
+	if _, err := os.Stat(conf.db); os.IsNotExist(err) {
+		return nil, fmt.Errorf("database not found: %s (create it with the import command)", conf.db)
+	}
+
+	return data.OpenSQLiteStore(conf.db)
+}
+
+// loadStore loads the CSV files, or the archives when given, in memory.
+func loadStore(conf *Config) (*data.Store, error) {
+	if len(conf.archives) > 0 {
+		return loadArchiveStore(conf.archives)
+	}
+
+	dir := conf.dataDir
+	if dir == "" {
+		dir = os.Getenv(envDataDir)
+	}
+	if dir == "" {
+		dir = defaultDataDir
+	}
+
+	actorsCSVFile, err := openCSVFile(dir, "actors", conf.actorsPath)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer actorsCSVFile.Close()
+
+	commitsCSVFile, err := openCSVFile(dir, "commits", conf.commitsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer commitsCSVFile.Close()
+
+	eventsCSVFile, err := openCSVFile(dir, "events", conf.eventsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer eventsCSVFile.Close()
+
+	reposCSVFile, err := openCSVFile(dir, "repos", conf.reposPath)
+	if err != nil {
+		return nil, err
 	}
+	defer reposCSVFile.Close()
 
-	store, err := data.NewStore(actorsCSVFile, commitsCSVFile,
+	return data.NewStore(actorsCSVFile, commitsCSVFile,
 		eventsCSVFile, reposCSVFile)
+}
+
+// openCSVFile opens the CSV file of the given name, at path when set or in
+// dir otherwise.
+func openCSVFile(dir, name, path string) (*os.File, error) {
+	if path == "" {
+		path = filepath.Join(dir, name+".csv")
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s file not found: %s (set -data-dir, %s or -%s)",
+			name, path, envDataDir, name)
+	}
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("%s file: %w", name, err)
 	}
 
-	an := analytics.New(store)
+	return f, nil
+}
 
-	switch conf.args[0] {
-	case "top10Users":
-		return handletop10Users(an)
-	case "top10ReposByCommitsPushed":
-		return handletop10ReposByCommitsPushed(an)
-	case "top10ReposByWatchEvents":
-		return handletop10ReposByByWatchEvents(an)
-	default:
-		return fmt.Errorf("unknown subcommand: %s", conf.args[0])
+func loadArchiveStore(paths []string) (*data.Store, error) {
+	archives := make([]io.Reader, len(paths))
+	for i, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		archives[i] = f
 	}
+
+	return data.NewStoreFromArchive(archives...)
 }
 
-func handletop10Users(an *analytics.Analytics) error {
-	users, err := an.ListUsers(
-		analytics.Sort([]analytics.SortCriteria{
-			analytics.CommitsPushed, analytics.PrCreated,
-		}),
-		analytics.Limit(10),
-	)
+func handleImport(ctx context.Context, conf *Config) (*report, error) {
+	if conf.db == "" {
+		return nil, fmt.Errorf("import requires the -db flag")
+	}
+
+	src, err := loadStore(conf)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', tabwriter.Debug)
-	fmt.Fprintln(tw, "ID\tUsername\t")
-	fmt.Fprintln(tw, "-\t-\t")
-	for _, u := range users {
-		fmt.Fprintf(tw, "%v\t%v\t\n", u.ID, u.Username)
+	db, err := data.OpenSQLiteStore(conf.db)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if err := db.ImportContext(ctx, src); err != nil {
+		return nil, err
+	}
+
+	rowCounts, err := db.RowCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts := []struct {
+		name  string
+		count int
+	}{
+		{"actors", rowCounts.Actors},
+		{"commits", rowCounts.Commits},
+		{"events", rowCounts.Events},
+		{"repos", rowCounts.Repos},
 	}
-	return tw.Flush()
+
+	r := &report{columns: []string{"Table", "Rows"}}
+	for _, c := range counts {
+		r.rows = append(r.rows, []string{c.name, strconv.Itoa(c.count)})
+		r.records = append(r.records, map[string]interface{}{"table": c.name, "rows": c.count})
+	}
+
+	return r, nil
 }
 
-func handletop10ReposByCommitsPushed(an *analytics.Analytics) error {
-	repos, err := an.ListRepos(
-		analytics.Sort([]analytics.SortCriteria{
-			analytics.CommitsPushed,
-		}),
-		analytics.Limit(10),
+// windowOptions returns the list options bounding the analyzed time window.
+func windowOptions(conf *Config) []func(*analytics.Analytics) error {
+	return []func(*analytics.Analytics) error{
+		analytics.Since(conf.since.Time),
+		analytics.Until(conf.until.Time),
+	}
+}
+
+// rankingOptions returns the list options of the users, repos and owners
+// subcommands.
+func rankingOptions(conf *Config) []func(*analytics.Analytics) error {
+	options := append(windowOptions(conf),
+		analytics.Sort(conf.sort),
+		analytics.Limit(conf.limit),
+		analytics.Offset(conf.offset),
+		analytics.Approximate(conf.approx),
 	)
+	if conf.weights != nil {
+		options = append(options, analytics.Weights(conf.weights))
+	}
+	if conf.tieBreak != "" {
+		options = append(options, analytics.TieBreak(analytics.TieBreaker(conf.tieBreak)))
+	}
+	return append(options, botOptions(conf)...)
+}
+
+// botOptions returns the list options detecting and filtering bots.
+func botOptions(conf *Config) []func(*analytics.Analytics) error {
+	var options []func(*analytics.Analytics) error
+	if len(conf.botPatterns) > 0 {
+		options = append(options, analytics.BotPatterns(conf.botPatterns))
+	}
+	switch {
+	case conf.excludeBots:
+		options = append(options, analytics.Bots(analytics.ExcludeBots))
+	case conf.onlyBots:
+		options = append(options, analytics.Bots(analytics.OnlyBots))
+	}
+	return options
+}
+
+func handleUsers(ctx context.Context, an *analytics.Analytics, conf *Config) (*report, error) {
+	users, err := an.ListUsersContext(ctx, rankingOptions(conf)...)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return usersReport(users), nil
+}
+
+func handleRepos(ctx context.Context, an *analytics.Analytics, conf *Config) (*report, error) {
+	repos, err := an.ListReposContext(ctx, rankingOptions(conf)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return reposReport(repos), nil
+}
+
+func handleOwners(ctx context.Context, an *analytics.Analytics, conf *Config) (*report, error) {
+	owners, err := an.ListOwnersContext(ctx, rankingOptions(conf)...)
+	if err != nil {
+		return nil, err
 	}
 
-	return printRepos(repos)
+	return ownersReport(owners), nil
 }
 
-func handletop10ReposByByWatchEvents(an *analytics.Analytics) error {
-	repos, err := an.ListRepos(
-		analytics.Sort([]analytics.SortCriteria{
-			analytics.SortCriteria(analytics.WatchEvent),
-		}),
-		analytics.Limit(10),
+func handleTimeseries(ctx context.Context, an *analytics.Analytics, conf *Config) (*report, error) {
+	options := append(windowOptions(conf),
+		analytics.ForActor(conf.actorID),
+		analytics.ForRepo(conf.repoID),
 	)
+	if conf.interval.Duration != 0 {
+		options = append(options, analytics.Interval(conf.interval.Duration))
+	}
+
+	series, err := an.SeriesContext(ctx, options...)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return seriesReport(series), nil
+}
+
+func handleSummary(ctx context.Context, an *analytics.Analytics, conf *Config) (*report, error) {
+	summary, err := an.SummaryContext(ctx,
+		append(windowOptions(conf), analytics.Approximate(conf.approx))...)
+	if err != nil {
+		return nil, err
+	}
+
+	return summaryReport(summary), nil
+}
+
+func handleBots(ctx context.Context, an *analytics.Analytics, conf *Config) (*report, error) {
+	bots, err := an.DetectBotsContext(ctx, append(windowOptions(conf), botOptions(conf)...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return botsReport(bots), nil
+}
+
+func handleUserProfile(ctx context.Context, an *analytics.Analytics, conf *Config) (*report, error) {
+	if len(conf.args) != 2 {
+		return nil, fmt.Errorf("usage: user ID|USERNAME")
 	}
 
-	return printRepos(repos)
+	p, err := an.UserProfileContext(ctx, conf.args[1], append(windowOptions(conf), botOptions(conf)...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return userProfileReport(p), nil
 }
 
-func printRepos(repos []analytics.Repo) error {
-	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', tabwriter.Debug)
-	fmt.Fprintln(tw, "ID\tName\t")
-	fmt.Fprintln(tw, "-\t-\t")
-	for _, r := range repos {
-		fmt.Fprintf(tw, "%v\t%v\t\n", r.ID, r.Name)
+func handleRepoProfile(ctx context.Context, an *analytics.Analytics, conf *Config) (*report, error) {
+	if len(conf.args) != 2 {
+		return nil, fmt.Errorf("usage: repo ID|OWNER/NAME")
 	}
-	return tw.Flush()
+
+	p, err := an.RepoProfileContext(ctx, conf.args[1], append(windowOptions(conf), botOptions(conf)...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return repoProfileReport(p), nil
 }
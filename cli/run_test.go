@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadStoreDataDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"actors.csv":  "id,username\n1,alice",
+		"commits.csv": "sha,message,event_id",
+		"events.csv":  "id,type,actor_id,repo_id\n1,WatchEvent,1,10",
+		"repos.csv":   "id,name\n10,alice/ten",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("flag", func(t *testing.T) {
+		if _, err := loadStore(&Config{dataDir: dir}); err != nil {
+			t.Errorf("err got %v, want nil", err)
+		}
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		t.Setenv(envDataDir, dir)
+		if _, err := loadStore(&Config{}); err != nil {
+			t.Errorf("err got %v, want nil", err)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		missing := filepath.Join(dir, "missing.csv")
+		_, err := loadStore(&Config{dataDir: dir, reposPath: missing})
+		if err == nil || !strings.Contains(err.Error(), "repos file not found: "+missing) {
+			t.Errorf("err got %v, want repos file not found error", err)
+		}
+	})
+}
@@ -0,0 +1,338 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+)
+
+// defaultAddr is the address the serve subcommand listens on unless -addr
+// is given.
+const defaultAddr = "localhost:8080"
+
+// maxServeLimit is the largest limit of the rankings served, larger ones
+// being rejected rather than computing an oversized page. A limit of 0 still
+// lists every entry, as with the CLI.
+const maxServeLimit = 1000
+
+// server answers the HTTP JSON API from a store loaded once, shared by every
+// request.
+type server struct {
+	an *analytics.Analytics
+}
+
+// newServer returns the handler of the HTTP JSON API:
+//
+//	GET /users            users ranking
+//	GET /users/{id|name}  user profile
+//	GET /repos            repositories ranking
+//	GET /repos/{id|name}  repository profile
+//	GET /owners           owners ranking
+//	GET /summary          event type breakdown
+//
+// The rankings accept the limit, offset, sort, weights, tiebreak, bots and
+// approx query parameters, the summary approx too, and every endpoint since
+// and until, mirroring the flags of the matching subcommands. Other methods
+// than GET are answered with a 405 status.
+func newServer(store analytics.Store) http.Handler {
+	s := &server{an: analytics.New(store)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users", getOnly(s.handleUsers))
+	mux.HandleFunc("/users/", getOnly(s.handleUserProfile))
+	mux.HandleFunc("/repos", getOnly(s.handleRepos))
+	mux.HandleFunc("/repos/", getOnly(s.handleRepoProfile))
+	mux.HandleFunc("/owners", getOnly(s.handleOwners))
+	mux.HandleFunc("/summary", getOnly(s.handleSummary))
+	return mux
+}
+
+// getOnly answers the requests of other methods than GET with a 405 status,
+// passing GET requests on to h.
+func getOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	options, err := rankingQueryOptions(r.URL.Query(),
+		sortValue{analytics.CommitsPushed, analytics.PrCreated})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	users, err := s.an.ListUsersContext(r.Context(), options...)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	if users == nil {
+		users = []analytics.UserResult{}
+	}
+	writeJSON(w, users)
+}
+
+func (s *server) handleRepos(w http.ResponseWriter, r *http.Request) {
+	options, err := rankingQueryOptions(r.URL.Query(), sortValue{analytics.CommitsPushed})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	repos, err := s.an.ListReposContext(r.Context(), options...)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	if repos == nil {
+		repos = []analytics.RepoResult{}
+	}
+	writeJSON(w, repos)
+}
+
+func (s *server) handleOwners(w http.ResponseWriter, r *http.Request) {
+	options, err := rankingQueryOptions(r.URL.Query(), nil)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	owners, err := s.an.ListOwnersContext(r.Context(), options...)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	if owners == nil {
+		owners = []analytics.OwnerResult{}
+	}
+	writeJSON(w, owners)
+}
+
+func (s *server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	options, err := windowQueryOptions(r.URL.Query())
+	if err == nil {
+		options, err = approxQueryOption(r.URL.Query(), options)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	summary, err := s.an.SummaryContext(r.Context(), options...)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, summary)
+}
+
+func (s *server) handleUserProfile(w http.ResponseWriter, r *http.Request) {
+	options, err := profileQueryOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/users/")
+	p, err := s.an.UserProfileContext(r.Context(), key, options...)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, p)
+}
+
+func (s *server) handleRepoProfile(w http.ResponseWriter, r *http.Request) {
+	options, err := profileQueryOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/repos/")
+	p, err := s.an.RepoProfileContext(r.Context(), key, options...)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, p)
+}
+
+// windowQueryOptions returns the options of the since and until query
+// parameters.
+func windowQueryOptions(q url.Values) ([]func(*analytics.Analytics) error, error) {
+	var since, until timeValue
+	if v := q.Get("since"); v != "" {
+		if err := since.Set(v); err != nil {
+			return nil, err
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if err := until.Set(v); err != nil {
+			return nil, err
+		}
+	}
+
+	return []func(*analytics.Analytics) error{
+		analytics.Since(since.Time),
+		analytics.Until(until.Time),
+	}, nil
+}
+
+// profileQueryOptions returns the options of the window and bots query
+// parameters.
+func profileQueryOptions(q url.Values) ([]func(*analytics.Analytics) error, error) {
+	options, err := windowQueryOptions(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if v := q.Get("bots"); v != "" {
+		options = append(options, analytics.Bots(analytics.BotFilter(v)))
+	}
+	return options, nil
+}
+
+// rankingQueryOptions returns the options of the ranking query parameters,
+// sorting by defaultSort unless sort or weights are given.
+func rankingQueryOptions(q url.Values, defaultSort sortValue) ([]func(*analytics.Analytics) error, error) {
+	options, err := profileQueryOptions(q)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := 10
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 || limit > maxServeLimit {
+			return nil, fmt.Errorf("invalid limit %q: must be between 0 and %d", v, maxServeLimit)
+		}
+	}
+	offset := 0
+	if v := q.Get("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	options = append(options, analytics.Limit(limit), analytics.Offset(offset))
+
+	criterion := defaultSort
+	if v := q.Get("sort"); v != "" {
+		if err := criterion.Set(v); err != nil {
+			return nil, err
+		}
+	}
+	if v := q.Get("weights"); v != "" {
+		var weights weightsValue
+		if err := weights.Set(v); err != nil {
+			return nil, err
+		}
+		options = append(options, analytics.Weights(weights))
+		if q.Get("sort") == "" {
+			criterion = nil
+		}
+	}
+	if criterion != nil {
+		options = append(options, analytics.Sort(criterion))
+	}
+
+	if v := q.Get("tiebreak"); v != "" {
+		options = append(options, analytics.TieBreak(analytics.TieBreaker(v)))
+	}
+	return approxQueryOption(q, options)
+}
+
+// approxQueryOption appends the option of the approx query parameter to
+// options.
+func approxQueryOption(q url.Values, options []func(*analytics.Analytics) error) ([]func(*analytics.Analytics) error, error) {
+	v := q.Get("approx")
+	if v == "" {
+		return options, nil
+	}
+
+	approx, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid approx %q", v)
+	}
+	return append(options, analytics.Approximate(approx)), nil
+}
+
+// errorStatus returns the HTTP status answering err, returned by Analytics:
+// 404 for unknown users and repositories, 400 for invalid options, 503 for
+// requests cancelled by their client or the shutdown of the server and 500
+// for the failures of the store.
+func errorStatus(err error) int {
+	var optionErr *analytics.OptionError
+	switch {
+	case errors.Is(err, analytics.ErrNotFound):
+		return http.StatusNotFound
+	case errors.As(err, &optionErr):
+		return http.StatusBadRequest
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("write response: %v", err)
+	}
+}
+
+// writeError answers the request with status and the message of err, which
+// is logged rather than disclosed for internal errors.
+func writeError(w http.ResponseWriter, status int, err error) {
+	if status == http.StatusInternalServerError {
+		log.Printf("internal error: %v", err)
+		err = errors.New(http.StatusText(status))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// serve answers the HTTP JSON API on addr until ctx is done, then shuts the
+// server down, cancelling the requests in flight.
+func serve(ctx context.Context, store analytics.Store, addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           newServer(store),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		log.Printf("serving on http://%s", addr)
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	}
+}
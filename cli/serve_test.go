@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+	"github.com/dikaeinstein/ghanalytics/data"
+)
+
+func TestServer(t *testing.T) {
+	store, err := data.NewStore(
+		strings.NewReader("id,username\n1,alice\n2,bob"),
+		strings.NewReader("sha,message,event_id\na1,first,10\na2,second,10\nb1,third,11"),
+		strings.NewReader(`id,type,actor_id,repo_id,created_at
+10,PushEvent,1,100,2020-01-01T15:00:00Z
+11,PushEvent,2,200,2020-01-01T16:00:00Z
+12,PullRequestEvent,2,100,2020-01-01T16:30:00Z
+13,WatchEvent,1,200,2020-01-01T17:00:00Z`),
+		strings.NewReader("id,name\n100,team/app\n200,bob/site"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(newServer(store))
+	defer srv.Close()
+
+	testCases := []struct {
+		path     string
+		status   int
+		expected string
+	}{
+		{
+			path:     "/users",
+			status:   http.StatusOK,
+			expected: `[{"id":1,"username":"alice","stats":{"commits":2,"pushes":1,"pullRequests":0,"watches":1,"total":2}},{"id":2,"username":"bob","stats":{"commits":1,"pushes":1,"pullRequests":1,"watches":0,"total":2}}]`,
+		},
+		{
+			path:     "/users?sort=prs&limit=1",
+			status:   http.StatusOK,
+			expected: `[{"id":2,"username":"bob","stats":{"commits":1,"pushes":1,"pullRequests":1,"watches":0,"total":1}}]`,
+		},
+		{
+			path:     "/repos?sort=watches&since=2020-01-01T16:00:00Z",
+			status:   http.StatusOK,
+			expected: `[{"id":200,"name":"bob/site","stats":{"commits":1,"pushes":1,"pullRequests":0,"watches":1,"total":1}}]`,
+		},
+		{
+			path:     "/repos?sort=forks",
+			status:   http.StatusOK,
+			expected: `[]`,
+		},
+		{
+			path:     "/owners?offset=1",
+			status:   http.StatusOK,
+			expected: `[{"owner":"bob","repos":1,"stats":{"commits":1,"pushes":1,"pullRequests":0,"watches":1,"total":3}}]`,
+		},
+		{
+			path:     "/summary?until=2020-01-01T16:00:00Z",
+			status:   http.StatusOK,
+			expected: `{"events":{"PushEvent":1},"totalEvents":1,"actors":1,"repos":1,"commits":2,"avgCommitsPerPush":2,"topUsersShare":1}`,
+		},
+		{
+			path:     "/users?sort=prs&limit=1&approx=true",
+			status:   http.StatusOK,
+			expected: `[{"id":2,"username":"bob","stats":{"commits":1,"pushes":1,"pullRequests":1,"watches":0,"total":1,"error":{"commits":1,"pushes":1,"pullRequests":1,"watches":1,"total":0}}}]`,
+		},
+		{
+			path:     "/summary?until=2020-01-01T16:00:00Z&approx=1",
+			status:   http.StatusOK,
+			expected: `{"events":{"PushEvent":1},"totalEvents":1,"actors":1,"repos":1,"commits":2,"avgCommitsPerPush":2,"topUsersShare":1,"error":{"actors":1,"repos":1,"topUsersShare":0}}`,
+		},
+		{path: "/users/bob", status: http.StatusOK},
+		{path: "/repos/team/app", status: http.StatusOK},
+		{path: "/users/nobody", status: http.StatusNotFound},
+		{path: "/users?limit=0", status: http.StatusOK},
+		{path: "/users?limit=1000", status: http.StatusOK},
+		{path: "/users?limit=1001", status: http.StatusBadRequest},
+		{path: "/users?limit=1000000000", status: http.StatusBadRequest},
+		{path: "/users?limit=-1", status: http.StatusBadRequest},
+		{path: "/users?sort=stars", status: http.StatusBadRequest},
+		{path: "/repos?bots=some", status: http.StatusBadRequest},
+		{path: "/users?approx=maybe", status: http.StatusBadRequest},
+		{path: "/owners?approx=true", status: http.StatusBadRequest},
+		{path: "/users?approx=true&bots=exclude", status: http.StatusBadRequest},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.path, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tC.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tC.status {
+				t.Errorf("status got %d, want %d", resp.StatusCode, tC.status)
+			}
+
+			var body json.RawMessage
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if tC.expected != "" && string(body) != tC.expected {
+				t.Errorf("body got %s, want %s", body, tC.expected)
+			}
+		})
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	// queries fail once the database is closed
+	db, err := data.OpenSQLiteStore(filepath.Join(t.TempDir(), "gh.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	srv := httptest.NewServer(newServer(db))
+	defer srv.Close()
+
+	testCases := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{method: http.MethodGet, path: "/users", status: http.StatusInternalServerError},
+		{method: http.MethodGet, path: "/summary", status: http.StatusInternalServerError},
+		{method: http.MethodGet, path: "/repos/team/app", status: http.StatusInternalServerError},
+		{method: http.MethodGet, path: "/users?sort=stars", status: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/users?tiebreak=age", status: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/users", status: http.StatusMethodNotAllowed},
+		{method: http.MethodDelete, path: "/repos/team/app", status: http.StatusMethodNotAllowed},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.method+" "+tC.path, func(t *testing.T) {
+			req, err := http.NewRequest(tC.method, srv.URL+tC.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tC.status {
+				t.Errorf("status got %d, want %d", resp.StatusCode, tC.status)
+			}
+		})
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	testCases := []struct {
+		err    error
+		status int
+	}{
+		{err: fmt.Errorf("find user: %w", analytics.ErrNotFound), status: http.StatusNotFound},
+		{err: &analytics.OptionError{Err: errors.New("invalid limit")}, status: http.StatusBadRequest},
+		{err: context.Canceled, status: http.StatusServiceUnavailable},
+		{err: fmt.Errorf("query: %w", context.DeadlineExceeded), status: http.StatusServiceUnavailable},
+		{err: errors.New("database is locked"), status: http.StatusInternalServerError},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.err.Error(), func(t *testing.T) {
+			if status := errorStatus(tC.err); status != tC.status {
+				t.Errorf("status got %d, want %d", status, tC.status)
+			}
+		})
+	}
+}
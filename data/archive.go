@@ -0,0 +1,170 @@
+package data
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+)
+
+// archiveEvent is the subset of a GH Archive event object that the store needs.
+type archiveEvent struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Actor struct {
+		ID    uint64 `json:"id"`
+		Login string `json:"login"`
+	} `json:"actor"`
+	Repo struct {
+		ID   uint64 `json:"id"`
+		Name string `json:"name"`
+	} `json:"repo"`
+	Payload struct {
+		Commits []struct {
+			Sha     string `json:"sha"`
+			Message string `json:"message"`
+		} `json:"commits"`
+	} `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewStoreFromArchive returns a new store that reads and loads its data from
+// GH Archive hourly dumps. Each archive holds one JSON event object per line
+// and may be gzip compressed, as published on gharchive.org.
+func NewStoreFromArchive(archives ...io.Reader) (*Store, error) {
+	l := newArchiveLoader()
+
+	for _, archive := range archives {
+		if err := l.load(archive); err != nil {
+			return nil, err
+		}
+	}
+
+	return newStore(l.users, l.commits, l.events, l.repos), nil
+}
+
+type archiveLoader struct {
+	commits []analytics.Commit
+	events  []analytics.Event
+	repos   []analytics.Repo
+	users   []analytics.Actor
+
+	shas     map[string]bool
+	eventIDs map[uint64]bool
+	repoIDs  map[uint64]bool
+	userIDs  map[uint64]bool
+}
+
+func newArchiveLoader() *archiveLoader {
+	return &archiveLoader{
+		shas:     make(map[string]bool),
+		eventIDs: make(map[uint64]bool),
+		repoIDs:  make(map[uint64]bool),
+		userIDs:  make(map[uint64]bool),
+	}
+}
+
+func (l *archiveLoader) load(archive io.Reader) error {
+	r, err := decompress(archive)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(r)
+	for {
+		var evt archiveEvent
+		err := dec.Decode(&evt)
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("invalid archive structure: %w", err)
+		}
+
+		if err := l.add(evt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *archiveLoader) add(evt archiveEvent) error {
+	eventID, err := strconv.ParseUint(evt.ID, 10, 64)
+	if err != nil {
+		return err
+	}
+	if l.eventIDs[eventID] {
+		return nil
+	}
+	l.eventIDs[eventID] = true
+
+	l.events = append(l.events, analytics.Event{
+		ID:        eventID,
+		Type:      analytics.EventType(evt.Type),
+		ActorID:   evt.Actor.ID,
+		RepoID:    evt.Repo.ID,
+		CreatedAt: evt.CreatedAt,
+	})
+
+	if !l.userIDs[evt.Actor.ID] {
+		l.userIDs[evt.Actor.ID] = true
+		l.users = append(l.users, analytics.Actor{
+			ID:       evt.Actor.ID,
+			Username: evt.Actor.Login,
+		})
+	}
+
+	if !l.repoIDs[evt.Repo.ID] {
+		l.repoIDs[evt.Repo.ID] = true
+		l.repos = append(l.repos, analytics.Repo{
+			ID:   evt.Repo.ID,
+			Name: evt.Repo.Name,
+		})
+	}
+
+	if analytics.EventType(evt.Type) != analytics.PushEvent {
+		return nil
+	}
+
+	for _, c := range evt.Payload.Commits {
+		if l.shas[c.Sha] {
+			continue
+		}
+		l.shas[c.Sha] = true
+		l.commits = append(l.commits, analytics.Commit{
+			Sha:     c.Sha,
+			Message: c.Message,
+			EventID: eventID,
+		})
+	}
+
+	return nil
+}
+
+// decompress transparently unwraps gzip compressed input, and passes plain
+// JSON through untouched.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(2)
+	if err == io.EOF {
+		return br, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(br)
+	}
+
+	return br, nil
+}
@@ -0,0 +1,101 @@
+package data_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+	"github.com/dikaeinstein/ghanalytics/data"
+)
+
+const archiveJSON = `{"id":"11185376329","type":"PushEvent","actor":{"id":8422699,"login":"Apexal"},"repo":{"id":224252202,"name":"DSC-RPI/dsc-portal"},"payload":{"push_id":4451283651,"size":2,"commits":[{"sha":"5948a6cc5255015e983a9719117c15ff197b4681","message":"Refactor member inde"},{"sha":"bf7296401598660b44d8923787a2600f346f9a81","message":"Refactor roadmap"}]},"public":true,"created_at":"2020-01-01T15:00:00Z"}
+{"id":"11185376341","type":"WatchEvent","actor":{"id":10052381,"login":"PercussiveElbow"},"repo":{"id":221552739,"name":"z0ph/aws-security-toolbox"},"payload":{"action":"started"},"public":true,"created_at":"2020-01-01T15:00:00Z"}
+{"id":"11185376343","type":"PushEvent","actor":{"id":8422699,"login":"Apexal"},"repo":{"id":224252202,"name":"DSC-RPI/dsc-portal"},"payload":{"push_id":4451283652,"size":1,"commits":[{"sha":"bf7296401598660b44d8923787a2600f346f9a81","message":"Refactor roadmap"}]},"public":true,"created_at":"2020-01-01T15:00:01Z"}
+{"id":"11185376341","type":"WatchEvent","actor":{"id":10052381,"login":"PercussiveElbow"},"repo":{"id":221552739,"name":"z0ph/aws-security-toolbox"},"payload":{"action":"started"},"public":true,"created_at":"2020-01-01T15:00:00Z"}
+`
+
+func TestNewStoreFromArchive(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		archive func(t *testing.T) io.Reader
+	}{
+		{desc: "gzip compressed", archive: gzipArchive},
+		{desc: "plain JSON", archive: func(t *testing.T) io.Reader {
+			return strings.NewReader(archiveJSON)
+		}},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			store, err := data.NewStoreFromArchive(tC.archive(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			hour := time.Date(2020, 1, 1, 15, 0, 0, 0, time.UTC)
+			events, _ := store.GetEvents(func(analytics.Event) bool { return true })
+			expectedEvents := []analytics.Event{
+				{ID: 11185376329, Type: analytics.PushEvent, ActorID: 8422699, RepoID: 224252202, CreatedAt: hour},
+				{ID: 11185376341, Type: analytics.WatchEvent, ActorID: 10052381, RepoID: 221552739, CreatedAt: hour},
+				{ID: 11185376343, Type: analytics.PushEvent, ActorID: 8422699, RepoID: 224252202, CreatedAt: hour.Add(time.Second)},
+			}
+			if !reflect.DeepEqual(events, expectedEvents) {
+				t.Errorf("Wrong events loaded. want %+v; got %+v", expectedEvents, events)
+			}
+
+			users, _ := store.GetUsers(func(analytics.Actor) bool { return true })
+			expectedUsers := []analytics.Actor{
+				{ID: 8422699, Username: "Apexal"},
+				{ID: 10052381, Username: "PercussiveElbow"},
+			}
+			if !reflect.DeepEqual(users, expectedUsers) {
+				t.Errorf("Wrong users loaded. want %+v; got %+v", expectedUsers, users)
+			}
+
+			commits, _ := store.GetCommits(func(analytics.Commit) bool { return true })
+			expectedCommits := []analytics.Commit{
+				{Sha: "5948a6cc5255015e983a9719117c15ff197b4681", Message: "Refactor member inde", EventID: 11185376329},
+				{Sha: "bf7296401598660b44d8923787a2600f346f9a81", Message: "Refactor roadmap", EventID: 11185376329},
+			}
+			if !reflect.DeepEqual(commits, expectedCommits) {
+				t.Errorf("Wrong commits loaded. want %+v; got %+v", expectedCommits, commits)
+			}
+
+			repos, _ := store.GetRepos(func(analytics.Repo) bool { return true })
+			expectedRepos := []analytics.Repo{
+				{ID: 224252202, Name: "DSC-RPI/dsc-portal"},
+				{ID: 221552739, Name: "z0ph/aws-security-toolbox"},
+			}
+			if !reflect.DeepEqual(repos, expectedRepos) {
+				t.Errorf("Wrong repos loaded. want %+v; got %+v", expectedRepos, repos)
+			}
+		})
+	}
+}
+
+func TestNewStoreFromArchiveInvalid(t *testing.T) {
+	_, err := data.NewStoreFromArchive(strings.NewReader(`{"id":"not-a-number"`))
+	if err == nil {
+		t.Error("expected error for truncated archive; got nil")
+	}
+}
+
+func gzipArchive(t *testing.T) io.Reader {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(archiveJSON)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &buf
+}
@@ -1,10 +1,14 @@
 package data
 
 import (
+	"context"
 	"encoding/csv"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dikaeinstein/ghanalytics/analytics"
 )
@@ -15,6 +19,57 @@ type Store struct {
 	events  []analytics.Event
 	repos   []analytics.Repo
 	users   []analytics.Actor
+
+	// Hash indexes built at load time. They hold positions in the slices
+	// above, in ascending order.
+	usersByID        map[uint64]int
+	reposByID        map[uint64]int
+	usersByName      map[string][]int
+	reposByName      map[string][]int
+	eventsByType     map[analytics.EventType][]int
+	eventsByActorID  map[uint64][]int
+	eventsByRepoID   map[uint64][]int
+	commitsByEventID map[uint64][]int
+}
+
+// newStore returns a store holding the given data, with its indexes built.
+func newStore(users []analytics.Actor, commits []analytics.Commit,
+	events []analytics.Event, repos []analytics.Repo) *Store {
+	s := &Store{
+		commits:          commits,
+		events:           events,
+		repos:            repos,
+		users:            users,
+		usersByID:        make(map[uint64]int, len(users)),
+		reposByID:        make(map[uint64]int, len(repos)),
+		usersByName:      make(map[string][]int, len(users)),
+		reposByName:      make(map[string][]int, len(repos)),
+		eventsByType:     make(map[analytics.EventType][]int),
+		eventsByActorID:  make(map[uint64][]int),
+		eventsByRepoID:   make(map[uint64][]int),
+		commitsByEventID: make(map[uint64][]int),
+	}
+
+	for i, u := range users {
+		s.usersByID[u.ID] = i
+		name := strings.ToLower(u.Username)
+		s.usersByName[name] = append(s.usersByName[name], i)
+	}
+	for i, r := range repos {
+		s.reposByID[r.ID] = i
+		name := strings.ToLower(r.Name)
+		s.reposByName[name] = append(s.reposByName[name], i)
+	}
+	for i, e := range events {
+		s.eventsByType[e.Type] = append(s.eventsByType[e.Type], i)
+		s.eventsByActorID[e.ActorID] = append(s.eventsByActorID[e.ActorID], i)
+		s.eventsByRepoID[e.RepoID] = append(s.eventsByRepoID[e.RepoID], i)
+	}
+	for i, c := range commits {
+		s.commitsByEventID[c.EventID] = append(s.commitsByEventID[c.EventID], i)
+	}
+
+	return s
 }
 
 // NewStore returns a new store that reads and loads its data from the CSV files
@@ -39,12 +94,7 @@ func NewStore(actorsCSVFile, commitsCSVFile, eventsCSVFile, reposCSVFile io.Read
 		return nil, err
 	}
 
-	return &Store{
-		commits: commits,
-		events:  events,
-		repos:   repos,
-		users:   users,
-	}, nil
+	return newStore(users, commits, events, repos), nil
 }
 
 func loadUsers(csvFile io.Reader) ([]analytics.Actor, error) {
@@ -151,9 +201,9 @@ func loadCommits(csvFile io.Reader) ([]analytics.Commit, error) {
 func loadEvents(csvFile io.Reader) ([]analytics.Event, error) {
 	var events []analytics.Event
 	reader := csv.NewReader(csvFile)
+	reader.FieldsPerRecord = -1
 
-	// skip header
-	_, err := reader.Read()
+	header, err := reader.Read()
 	if err == io.EOF {
 		return events, nil
 	}
@@ -161,6 +211,14 @@ func loadEvents(csvFile io.Reader) ([]analytics.Event, error) {
 		return events, err
 	}
 
+	// created_at is optional, older exports only have the first four columns
+	createdAtColumn := -1
+	for i, column := range header {
+		if column == "created_at" {
+			createdAtColumn = i
+		}
+	}
+
 	for {
 		line, err := reader.Read()
 
@@ -188,11 +246,19 @@ func loadEvents(csvFile io.Reader) ([]analytics.Event, error) {
 		if err != nil {
 			return events, err
 		}
+		var createdAt time.Time
+		if createdAtColumn >= 0 && createdAtColumn < len(line) && line[createdAtColumn] != "" {
+			createdAt, err = time.Parse(time.RFC3339, line[createdAtColumn])
+			if err != nil {
+				return events, err
+			}
+		}
 		events = append(events, analytics.Event{
-			ID:      eventID,
-			Type:    analytics.EventType(line[1]),
-			ActorID: actorID,
-			RepoID:  repoID,
+			ID:        eventID,
+			Type:      analytics.EventType(line[1]),
+			ActorID:   actorID,
+			RepoID:    repoID,
+			CreatedAt: createdAt,
 		})
 	}
 
@@ -259,9 +325,16 @@ func loadRepos(csvFile io.Reader) ([]analytics.Repo, error) {
 }
 
 func (s *Store) GetUsers(f func(analytics.Actor) bool) ([]analytics.Actor, error) {
+	return s.GetUsersContext(context.Background(), f)
+}
+
+func (s *Store) GetUsersContext(ctx context.Context, f func(analytics.Actor) bool) ([]analytics.Actor, error) {
 	var matchingUsers []analytics.Actor
 
-	for _, u := range s.users {
+	for i, u := range s.users {
+		if err := checkContext(ctx, i); err != nil {
+			return nil, err
+		}
 		if matching := f(u); matching {
 			matchingUsers = append(matchingUsers, u)
 		}
@@ -271,9 +344,16 @@ func (s *Store) GetUsers(f func(analytics.Actor) bool) ([]analytics.Actor, error
 }
 
 func (s *Store) GetEvents(f func(analytics.Event) bool) ([]analytics.Event, error) {
+	return s.GetEventsContext(context.Background(), f)
+}
+
+func (s *Store) GetEventsContext(ctx context.Context, f func(analytics.Event) bool) ([]analytics.Event, error) {
 	var matchingEvents []analytics.Event
 
-	for _, e := range s.events {
+	for i, e := range s.events {
+		if err := checkContext(ctx, i); err != nil {
+			return nil, err
+		}
 		if matching := f(e); matching {
 			matchingEvents = append(matchingEvents, e)
 		}
@@ -283,9 +363,16 @@ func (s *Store) GetEvents(f func(analytics.Event) bool) ([]analytics.Event, erro
 }
 
 func (s *Store) GetRepos(f func(analytics.Repo) bool) ([]analytics.Repo, error) {
+	return s.GetReposContext(context.Background(), f)
+}
+
+func (s *Store) GetReposContext(ctx context.Context, f func(analytics.Repo) bool) ([]analytics.Repo, error) {
 	var matchingRepos []analytics.Repo
 
-	for _, r := range s.repos {
+	for i, r := range s.repos {
+		if err := checkContext(ctx, i); err != nil {
+			return nil, err
+		}
 		if matching := f(r); matching {
 			matchingRepos = append(matchingRepos, r)
 		}
@@ -293,3 +380,228 @@ func (s *Store) GetRepos(f func(analytics.Repo) bool) ([]analytics.Repo, error)
 
 	return matchingRepos, nil
 }
+
+func (s *Store) GetCommits(f func(analytics.Commit) bool) ([]analytics.Commit, error) {
+	return s.GetCommitsContext(context.Background(), f)
+}
+
+func (s *Store) GetCommitsContext(ctx context.Context, f func(analytics.Commit) bool) ([]analytics.Commit, error) {
+	var matchingCommits []analytics.Commit
+
+	for i, c := range s.commits {
+		if err := checkContext(ctx, i); err != nil {
+			return nil, err
+		}
+		if matching := f(c); matching {
+			matchingCommits = append(matchingCommits, c)
+		}
+	}
+
+	return matchingCommits, nil
+}
+
+// checkInterval is the number of records scanned between two checks of the
+// context, keeping the cost of the checks negligible.
+const checkInterval = 4096
+
+// checkContext returns the context's error once ctx is done, checking it
+// every checkInterval records only.
+func checkContext(ctx context.Context, scanned int) error {
+	if scanned%checkInterval != 0 {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// ForEachEvent calls f with every event matching filter, along with the
+// number of commits it pushed. Candidates are taken from the most selective
+// of the type, actor and repository indexes.
+func (s *Store) ForEachEvent(ctx context.Context, filter analytics.EventFilter, f func(analytics.Event, int) error) error {
+	candidates, indexed := s.candidates(filter)
+
+	n := 0
+	visit := func(e analytics.Event) error {
+		if err := checkContext(ctx, n); err != nil {
+			return err
+		}
+		n++
+		if !filter.Match(e) {
+			return nil
+		}
+
+		commits := 0
+		if e.Type == analytics.PushEvent {
+			commits = len(s.commitsByEventID[e.ID])
+		}
+		return f(e, commits)
+	}
+
+	var err error
+	if indexed {
+		err = mergePositions(candidates, func(i int) error { return visit(s.events[i]) })
+	} else {
+		for _, e := range s.events {
+			if err = visit(e); err != nil {
+				break
+			}
+		}
+	}
+
+	if err == analytics.ErrStopScan {
+		return nil
+	}
+	return err
+}
+
+// candidates returns the positions of the events possibly matching filter,
+// taken from the most selective of the type, actor and repository indexes:
+// the single list of the actor or repository, or one list per type. indexed
+// is false when no index applies and every event is a candidate.
+func (s *Store) candidates(filter analytics.EventFilter) (candidates [][]int, indexed bool) {
+	size := func(lists [][]int) int {
+		n := 0
+		for _, positions := range lists {
+			n += len(positions)
+		}
+		return n
+	}
+	narrow := func(lists [][]int) {
+		if !indexed || size(lists) < size(candidates) {
+			candidates = lists
+			indexed = true
+		}
+	}
+
+	if filter.ActorID != 0 {
+		narrow([][]int{s.eventsByActorID[filter.ActorID]})
+	}
+	if filter.RepoID != 0 {
+		narrow([][]int{s.eventsByRepoID[filter.RepoID]})
+	}
+	if len(filter.Types) > 0 {
+		types := uniqueEventTypes(filter.Types)
+		lists := make([][]int, len(types))
+		for i, t := range types {
+			lists[i] = s.eventsByType[t]
+		}
+		narrow(lists)
+	}
+
+	return candidates, indexed
+}
+
+// mergePositions calls f with the positions held by lists, each in ascending
+// order, merging them in ascending order as it goes rather than collecting
+// them. It stops at the first error f returns.
+func mergePositions(lists [][]int, f func(int) error) error {
+	cursors := make([]int, len(lists))
+	for {
+		next := -1
+		for l, positions := range lists {
+			if cursors[l] == len(positions) {
+				continue
+			}
+			if next < 0 || positions[cursors[l]] < lists[next][cursors[next]] {
+				next = l
+			}
+		}
+		if next < 0 {
+			return nil
+		}
+
+		if err := f(lists[next][cursors[next]]); err != nil {
+			return err
+		}
+		cursors[next]++
+	}
+}
+
+func uniqueEventTypes(types []analytics.EventType) []analytics.EventType {
+	seen := make(map[analytics.EventType]bool, len(types))
+	var unique []analytics.EventType
+	for _, t := range types {
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+func (s *Store) GetEventTypes(ctx context.Context) ([]analytics.EventType, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	types := make([]analytics.EventType, 0, len(s.eventsByType))
+	for t := range s.eventsByType {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types, nil
+}
+
+func (s *Store) GetUsersByIDs(ctx context.Context, ids []uint64) ([]analytics.Actor, error) {
+	users := make([]analytics.Actor, 0, len(ids))
+	for n, id := range ids {
+		if err := checkContext(ctx, n); err != nil {
+			return nil, err
+		}
+		if i, ok := s.usersByID[id]; ok {
+			users = append(users, s.users[i])
+		}
+	}
+	return users, nil
+}
+
+func (s *Store) GetReposByIDs(ctx context.Context, ids []uint64) ([]analytics.Repo, error) {
+	repos := make([]analytics.Repo, 0, len(ids))
+	for n, id := range ids {
+		if err := checkContext(ctx, n); err != nil {
+			return nil, err
+		}
+		if i, ok := s.reposByID[id]; ok {
+			repos = append(repos, s.repos[i])
+		}
+	}
+	return repos, nil
+}
+
+func (s *Store) GetUsersByNames(ctx context.Context, names []string) ([]analytics.Actor, error) {
+	var users []analytics.Actor
+	for n, name := range names {
+		if err := checkContext(ctx, n); err != nil {
+			return nil, err
+		}
+		for _, i := range s.usersByName[strings.ToLower(name)] {
+			users = append(users, s.users[i])
+		}
+	}
+	return users, nil
+}
+
+func (s *Store) GetReposByNames(ctx context.Context, names []string) ([]analytics.Repo, error) {
+	var repos []analytics.Repo
+	for n, name := range names {
+		if err := checkContext(ctx, n); err != nil {
+			return nil, err
+		}
+		for _, i := range s.reposByName[strings.ToLower(name)] {
+			repos = append(repos, s.repos[i])
+		}
+	}
+	return repos, nil
+}
+
+func (s *Store) GetCommitsByEventIDs(ctx context.Context, eventIDs []uint64) ([]analytics.Commit, error) {
+	var commits []analytics.Commit
+	for n, id := range eventIDs {
+		if err := checkContext(ctx, n); err != nil {
+			return nil, err
+		}
+		for _, i := range s.commitsByEventID[id] {
+			commits = append(commits, s.commits[i])
+		}
+	}
+	return commits, nil
+}
@@ -0,0 +1,125 @@
+package data_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+	"github.com/dikaeinstein/ghanalytics/data"
+)
+
+// loadBundledStore loads the CSV dataset shipped in this directory.
+func loadBundledStore(b *testing.B) *data.Store {
+	b.Helper()
+
+	open := func(name string) *os.File {
+		f, err := os.Open(name + ".csv")
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { f.Close() })
+		return f
+	}
+
+	store, err := data.NewStore(open("actors"), open("commits"), open("events"), open("repos"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return store
+}
+
+// The scan benchmarks answer the same lookups as their indexed counterparts
+// through the predicate based getters, to show the speedup of the indexes.
+
+const benchActorID = 29139614
+
+func BenchmarkEventsByActorScan(b *testing.B) {
+	store := loadBundledStore(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = store.GetEvents(func(e analytics.Event) bool {
+			return e.ActorID == benchActorID && e.Type == analytics.PushEvent
+		})
+	}
+}
+
+func BenchmarkEventsByActorIndexed(b *testing.B) {
+	store := loadBundledStore(b)
+	filter := analytics.EventFilter{
+		ActorID: benchActorID,
+		Types:   []analytics.EventType{analytics.PushEvent},
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = queryEvents(store, filter)
+	}
+}
+
+func benchIDs(b *testing.B, store *data.Store) []uint64 {
+	b.Helper()
+
+	users, err := store.GetUsers(func(analytics.Actor) bool { return true })
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	ids := make([]uint64, 0, 100)
+	for i := 0; i < len(users) && len(ids) < cap(ids); i += len(users) / cap(ids) {
+		ids = append(ids, users[i].ID)
+	}
+	return ids
+}
+
+func BenchmarkUsersByIDsScan(b *testing.B) {
+	store := loadBundledStore(b)
+	ids := benchIDs(b, store)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, id := range ids {
+			_, _ = store.GetUsers(func(u analytics.Actor) bool { return u.ID == id })
+		}
+	}
+}
+
+func BenchmarkUsersByIDsIndexed(b *testing.B) {
+	store := loadBundledStore(b)
+	ids := benchIDs(b, store)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = store.GetUsersByIDs(context.Background(), ids)
+	}
+}
+
+func BenchmarkCommitsByEventIDsScan(b *testing.B) {
+	store := loadBundledStore(b)
+	pushes, _ := queryEvents(store, analytics.EventFilter{Types: []analytics.EventType{analytics.PushEvent}})
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ids := make(map[uint64]bool, len(pushes))
+		for _, e := range pushes {
+			ids[e.ID] = true
+		}
+		_, _ = store.GetCommits(func(c analytics.Commit) bool { return ids[c.EventID] })
+	}
+}
+
+func BenchmarkCommitsByEventIDsIndexed(b *testing.B) {
+	store := loadBundledStore(b)
+	pushes, _ := queryEvents(store, analytics.EventFilter{Types: []analytics.EventType{analytics.PushEvent}})
+	ids := make([]uint64, len(pushes))
+	for i, e := range pushes {
+		ids[i] = e.ID
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = store.GetCommitsByEventIDs(context.Background(), ids)
+	}
+}
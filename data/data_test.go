@@ -0,0 +1,299 @@
+package data_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+	"github.com/dikaeinstein/ghanalytics/data"
+)
+
+func createStore(t *testing.T) *data.Store {
+	t.Helper()
+
+	store, err := data.NewStore(
+		strings.NewReader("id,username\n1,alice\n2,bob\n3,carol"),
+		strings.NewReader("sha,message,event_id\na1,first,100\na2,second,100\nb1,third,102\nc1,fourth,104"),
+		strings.NewReader(`id,type,actor_id,repo_id
+100,PushEvent,1,10
+101,WatchEvent,2,10
+102,PushEvent,2,20
+103,PullRequestEvent,1,20
+104,PushEvent,1,20
+105,WatchEvent,3,20`),
+		strings.NewReader("id,name\n10,alice/ten\n20,bob/twenty"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestStoreLookups(t *testing.T) {
+	src := createStore(t)
+
+	db, err := data.OpenSQLiteStore(filepath.Join(t.TempDir(), "gh.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Import(src); err != nil {
+		t.Fatal(err)
+	}
+
+	stores := []struct {
+		name  string
+		store analytics.Store
+	}{
+		{"memory", src},
+		{"sqlite", db},
+	}
+
+	filters := []analytics.EventFilter{
+		{},
+		{ActorID: 1},
+		{RepoID: 20},
+		{Types: []analytics.EventType{analytics.WatchEvent}},
+		{Types: []analytics.EventType{analytics.WatchEvent, analytics.PushEvent, analytics.WatchEvent}},
+		{Types: []analytics.EventType{analytics.PushEvent, analytics.PullRequestEvent, analytics.WatchEvent}},
+		{ActorID: 1, RepoID: 20, Types: []analytics.EventType{analytics.PushEvent}},
+		{ActorID: 42},
+	}
+
+	for _, s := range stores {
+		t.Run(s.name, func(t *testing.T) {
+			for _, f := range filters {
+				want, _ := src.GetEvents(f.Match)
+				scanned, err := queryEvents(s.store, f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(scanned, want) {
+					t.Errorf("ForEachEvent(%+v) got %+v, want %+v", f, scanned, want)
+				}
+			}
+
+			users, err := s.store.GetUsersByIDs(context.Background(), []uint64{3, 42, 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantUsers := []analytics.Actor{{ID: 3, Username: "carol"}, {ID: 1, Username: "alice"}}
+			if !reflect.DeepEqual(users, wantUsers) {
+				t.Errorf("GetUsersByIDs got %+v, want %+v", users, wantUsers)
+			}
+
+			users, err = s.store.GetUsersByNames(context.Background(), []string{"Carol", "nobody", "alice"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(users, wantUsers) {
+				t.Errorf("GetUsersByNames got %+v, want %+v", users, wantUsers)
+			}
+
+			repos, err := s.store.GetReposByIDs(context.Background(), []uint64{20})
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantRepos := []analytics.Repo{{ID: 20, Name: "bob/twenty"}}
+			if !reflect.DeepEqual(repos, wantRepos) {
+				t.Errorf("GetReposByIDs got %+v, want %+v", repos, wantRepos)
+			}
+
+			repos, err = s.store.GetReposByNames(context.Background(), []string{"BOB/twenty", "bob/thirty"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(repos, wantRepos) {
+				t.Errorf("GetReposByNames got %+v, want %+v", repos, wantRepos)
+			}
+
+			types, err := s.store.GetEventTypes(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantTypes := []analytics.EventType{analytics.PullRequestEvent, analytics.PushEvent, analytics.WatchEvent}
+			if !reflect.DeepEqual(types, wantTypes) {
+				t.Errorf("GetEventTypes got %+v, want %+v", types, wantTypes)
+			}
+
+			commits, err := s.store.GetCommitsByEventIDs(context.Background(), []uint64{100, 101, 104})
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantCommits := []analytics.Commit{
+				{Sha: "a1", Message: "first", EventID: 100},
+				{Sha: "a2", Message: "second", EventID: 100},
+				{Sha: "c1", Message: "fourth", EventID: 104},
+			}
+			if !reflect.DeepEqual(commits, wantCommits) {
+				t.Errorf("GetCommitsByEventIDs got %+v, want %+v", commits, wantCommits)
+			}
+		})
+	}
+}
+
+// queryEvents collects the events matching filter through ForEachEvent.
+func queryEvents(store analytics.Store, filter analytics.EventFilter) ([]analytics.Event, error) {
+	var events []analytics.Event
+	err := store.ForEachEvent(context.Background(), filter, func(e analytics.Event, _ int) error {
+		events = append(events, e)
+		return nil
+	})
+	return events, err
+}
+
+func TestStoreCancellation(t *testing.T) {
+	src := createStore(t)
+
+	db, err := data.OpenSQLiteStore(filepath.Join(t.TempDir(), "gh.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := db.ImportContext(ctx, src); !errors.Is(err, context.Canceled) {
+		t.Errorf("ImportContext err got %v, want %v", err, context.Canceled)
+	}
+
+	stores := []struct {
+		name  string
+		store analytics.Store
+	}{
+		{"memory", src},
+		{"sqlite", db},
+	}
+
+	for _, s := range stores {
+		t.Run(s.name, func(t *testing.T) {
+			scans := map[string]func() error{
+				"GetUsersContext": func() error {
+					_, err := s.store.GetUsersContext(ctx, func(analytics.Actor) bool { return true })
+					return err
+				},
+				"GetEventsContext": func() error {
+					_, err := s.store.GetEventsContext(ctx, func(analytics.Event) bool { return true })
+					return err
+				},
+				"GetReposContext": func() error {
+					_, err := s.store.GetReposContext(ctx, func(analytics.Repo) bool { return true })
+					return err
+				},
+				"GetCommitsContext": func() error {
+					_, err := s.store.GetCommitsContext(ctx, func(analytics.Commit) bool { return true })
+					return err
+				},
+				"ForEachEvent": func() error {
+					return s.store.ForEachEvent(ctx, analytics.EventFilter{}, func(analytics.Event, int) error { return nil })
+				},
+				"GetEventTypes": func() error {
+					_, err := s.store.GetEventTypes(ctx)
+					return err
+				},
+				"GetUsersByIDs": func() error {
+					_, err := s.store.GetUsersByIDs(ctx, []uint64{1})
+					return err
+				},
+				"GetReposByNames": func() error {
+					_, err := s.store.GetReposByNames(ctx, []string{"alice/ten"})
+					return err
+				},
+				"GetCommitsByEventIDs": func() error {
+					_, err := s.store.GetCommitsByEventIDs(ctx, []uint64{100})
+					return err
+				},
+				"ForEachEvent by type": func() error {
+					filter := analytics.EventFilter{Types: []analytics.EventType{analytics.PushEvent, analytics.WatchEvent}}
+					return s.store.ForEachEvent(ctx, filter, func(analytics.Event, int) error { return nil })
+				},
+			}
+
+			for name, scan := range scans {
+				if err := scan(); !errors.Is(err, context.Canceled) {
+					t.Errorf("%s err got %v, want %v", name, err, context.Canceled)
+				}
+			}
+		})
+	}
+}
+
+func TestForEachEvent(t *testing.T) {
+	src := createStore(t)
+
+	db, err := data.OpenSQLiteStore(filepath.Join(t.TempDir(), "gh.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Import(src); err != nil {
+		t.Fatal(err)
+	}
+
+	stores := []struct {
+		name  string
+		store analytics.Store
+	}{
+		{"memory", src},
+		{"sqlite", db},
+	}
+
+	events, _ := src.GetEvents(func(analytics.Event) bool { return true })
+	wantCommits := make(map[uint64]int)
+	for _, e := range events {
+		if e.Type != analytics.PushEvent {
+			continue
+		}
+		commits, _ := src.GetCommitsByEventIDs(context.Background(), []uint64{e.ID})
+		wantCommits[e.ID] = len(commits)
+	}
+
+	for _, s := range stores {
+		t.Run(s.name, func(t *testing.T) {
+			gotCommits := make(map[uint64]int)
+			err := s.store.ForEachEvent(context.Background(), analytics.EventFilter{}, func(e analytics.Event, commits int) error {
+				if e.Type == analytics.PushEvent {
+					gotCommits[e.ID] = commits
+				} else if commits != 0 {
+					t.Errorf("Wrong commits returned for %s %d. want 0; got %d", e.Type, e.ID, commits)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotCommits, wantCommits) {
+				t.Errorf("Wrong commits returned. want %+v; got %+v", wantCommits, gotCommits)
+			}
+
+			scanned := 0
+			err = s.store.ForEachEvent(context.Background(), analytics.EventFilter{}, func(analytics.Event, int) error {
+				scanned++
+				if scanned == 2 {
+					return analytics.ErrStopScan
+				}
+				return nil
+			})
+			if err != nil {
+				t.Errorf("ForEachEvent stopped with err %v, want nil", err)
+			}
+			if scanned != 2 {
+				t.Errorf("Wrong number of events scanned. want 2; got %d", scanned)
+			}
+
+			errBoom := errors.New("boom")
+			err = s.store.ForEachEvent(context.Background(), analytics.EventFilter{}, func(analytics.Event, int) error {
+				return errBoom
+			})
+			if !errors.Is(err, errBoom) {
+				t.Errorf("ForEachEvent err got %v, want %v", err, errBoom)
+			}
+		})
+	}
+}
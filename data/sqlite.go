@@ -0,0 +1,523 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+
+	// registers the pure Go "sqlite" database/sql driver
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS actors (
+	id       INTEGER PRIMARY KEY,
+	username TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS actors_username ON actors (username COLLATE NOCASE);
+CREATE TABLE IF NOT EXISTS repos (
+	id   INTEGER PRIMARY KEY,
+	name TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS repos_name ON repos (name COLLATE NOCASE);
+CREATE TABLE IF NOT EXISTS events (
+	id         INTEGER PRIMARY KEY,
+	type       TEXT NOT NULL,
+	actor_id   INTEGER NOT NULL,
+	repo_id    INTEGER NOT NULL,
+	created_at INTEGER
+);
+CREATE INDEX IF NOT EXISTS events_type ON events (type);
+CREATE INDEX IF NOT EXISTS events_actor_id ON events (actor_id);
+CREATE INDEX IF NOT EXISTS events_repo_id ON events (repo_id);
+CREATE INDEX IF NOT EXISTS events_created_at ON events (created_at);
+CREATE TABLE IF NOT EXISTS commits (
+	sha      TEXT PRIMARY KEY,
+	message  TEXT NOT NULL,
+	event_id INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS commits_event_id ON commits (event_id);
+`
+
+// SQLiteStore is a persistent data storage for the Github data, backed by an
+// embedded SQLite database. Data is loaded once with Import and then
+// queried by every subsequent invocation.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStore opens the SQLite database at path, creating it and its
+// schema when missing.
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Import copies the data held by src into the database. Rows already present
+// are kept, so several sources can be imported into the same database.
+func (s *SQLiteStore) Import(src *Store) error {
+	return s.ImportContext(context.Background(), src)
+}
+
+// ImportContext is like Import, rolling back and returning the context's
+// error once ctx is done.
+func (s *SQLiteStore) ImportContext(ctx context.Context, src *Store) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO actors (id, username) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+	for _, u := range src.users {
+		if _, err := stmt.ExecContext(ctx, int64(u.ID), u.Username); err != nil {
+			return err
+		}
+	}
+
+	stmt, err = tx.PrepareContext(ctx, `INSERT OR IGNORE INTO repos (id, name) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+	for _, r := range src.repos {
+		if _, err := stmt.ExecContext(ctx, int64(r.ID), r.Name); err != nil {
+			return err
+		}
+	}
+
+	stmt, err = tx.PrepareContext(ctx, `INSERT OR IGNORE INTO events (id, type, actor_id, repo_id, created_at)
+		VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	for _, e := range src.events {
+		var createdAt sql.NullInt64
+		if !e.CreatedAt.IsZero() {
+			createdAt = sql.NullInt64{Int64: e.CreatedAt.UnixNano(), Valid: true}
+		}
+		_, err := stmt.ExecContext(ctx, int64(e.ID), string(e.Type), int64(e.ActorID),
+			int64(e.RepoID), createdAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	stmt, err = tx.PrepareContext(ctx, `INSERT OR IGNORE INTO commits (sha, message, event_id) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	for _, c := range src.commits {
+		if _, err := stmt.ExecContext(ctx, c.Sha, c.Message, int64(c.EventID)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RowCounts is the number of rows held by each table of a SQLiteStore.
+type RowCounts struct {
+	Actors  int
+	Commits int
+	Events  int
+	Repos   int
+}
+
+// RowCounts returns the number of rows held by each table, counted by the
+// database rather than read.
+func (s *SQLiteStore) RowCounts(ctx context.Context) (RowCounts, error) {
+	var c RowCounts
+	err := s.db.QueryRowContext(ctx, `SELECT
+		(SELECT COUNT(*) FROM actors),
+		(SELECT COUNT(*) FROM commits),
+		(SELECT COUNT(*) FROM events),
+		(SELECT COUNT(*) FROM repos)`).Scan(&c.Actors, &c.Commits, &c.Events, &c.Repos)
+	return c, err
+}
+
+func (s *SQLiteStore) GetUsers(f func(analytics.Actor) bool) ([]analytics.Actor, error) {
+	return s.GetUsersContext(context.Background(), f)
+}
+
+func (s *SQLiteStore) GetUsersContext(ctx context.Context, f func(analytics.Actor) bool) ([]analytics.Actor, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, username FROM actors ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matchingUsers []analytics.Actor
+	for rows.Next() {
+		var u analytics.Actor
+		if err := rows.Scan(&u.ID, &u.Username); err != nil {
+			return nil, err
+		}
+		if matching := f(u); matching {
+			matchingUsers = append(matchingUsers, u)
+		}
+	}
+
+	return matchingUsers, rows.Err()
+}
+
+func (s *SQLiteStore) GetEvents(f func(analytics.Event) bool) ([]analytics.Event, error) {
+	return s.GetEventsContext(context.Background(), f)
+}
+
+func (s *SQLiteStore) GetEventsContext(ctx context.Context, f func(analytics.Event) bool) ([]analytics.Event, error) {
+	return s.queryEvents(ctx, `SELECT id, type, actor_id, repo_id, created_at FROM events ORDER BY rowid`, nil, f)
+}
+
+// ForEachEvent calls f with every event matching filter, along with the
+// number of commits it pushed, as the rows are read from the database. Events
+// are selected through the events table indexes.
+func (s *SQLiteStore) ForEachEvent(ctx context.Context, filter analytics.EventFilter, f func(analytics.Event, int) error) error {
+	where, args := eventConditions(filter)
+	query := `SELECT id, type, actor_id, repo_id, created_at,
+		CASE WHEN type = 'PushEvent'
+			THEN (SELECT COUNT(*) FROM commits WHERE commits.event_id = events.id)
+			ELSE 0 END
+		FROM events` + where + ` ORDER BY rowid`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e analytics.Event
+		var createdAt sql.NullInt64
+		var commits int
+		if err := rows.Scan(&e.ID, &e.Type, &e.ActorID, &e.RepoID, &createdAt, &commits); err != nil {
+			return err
+		}
+		if createdAt.Valid {
+			e.CreatedAt = time.Unix(0, createdAt.Int64).UTC()
+		}
+		if err := f(e, commits); err != nil {
+			if err == analytics.ErrStopScan {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// eventConditions returns the WHERE clause selecting the events matching
+// filter, empty when it matches every event, along with its arguments.
+func eventConditions(filter analytics.EventFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if len(filter.Types) > 0 {
+		placeholders := make([]string, len(filter.Types))
+		for i, t := range filter.Types {
+			placeholders[i] = "?"
+			args = append(args, string(t))
+		}
+		conditions = append(conditions, "type IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	if filter.ActorID != 0 {
+		conditions = append(conditions, "actor_id = ?")
+		args = append(args, int64(filter.ActorID))
+	}
+	if filter.RepoID != 0 {
+		conditions = append(conditions, "repo_id = ?")
+		args = append(args, int64(filter.RepoID))
+	}
+	if !filter.Since.IsZero() || !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at IS NOT NULL")
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since.UnixNano())
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until.UnixNano())
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func (s *SQLiteStore) queryEvents(ctx context.Context, query string, args []interface{}, f func(analytics.Event) bool) ([]analytics.Event, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matchingEvents []analytics.Event
+	for rows.Next() {
+		var e analytics.Event
+		var createdAt sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.Type, &e.ActorID, &e.RepoID, &createdAt); err != nil {
+			return nil, err
+		}
+		if createdAt.Valid {
+			e.CreatedAt = time.Unix(0, createdAt.Int64).UTC()
+		}
+		if matching := f(e); matching {
+			matchingEvents = append(matchingEvents, e)
+		}
+	}
+
+	return matchingEvents, rows.Err()
+}
+
+func (s *SQLiteStore) GetRepos(f func(analytics.Repo) bool) ([]analytics.Repo, error) {
+	return s.GetReposContext(context.Background(), f)
+}
+
+func (s *SQLiteStore) GetReposContext(ctx context.Context, f func(analytics.Repo) bool) ([]analytics.Repo, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, name FROM repos ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matchingRepos []analytics.Repo
+	for rows.Next() {
+		var r analytics.Repo
+		if err := rows.Scan(&r.ID, &r.Name); err != nil {
+			return nil, err
+		}
+		if matching := f(r); matching {
+			matchingRepos = append(matchingRepos, r)
+		}
+	}
+
+	return matchingRepos, rows.Err()
+}
+
+func (s *SQLiteStore) GetCommits(f func(analytics.Commit) bool) ([]analytics.Commit, error) {
+	return s.GetCommitsContext(context.Background(), f)
+}
+
+func (s *SQLiteStore) GetCommitsContext(ctx context.Context, f func(analytics.Commit) bool) ([]analytics.Commit, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT sha, message, event_id FROM commits ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matchingCommits []analytics.Commit
+	for rows.Next() {
+		var c analytics.Commit
+		if err := rows.Scan(&c.Sha, &c.Message, &c.EventID); err != nil {
+			return nil, err
+		}
+		if matching := f(c); matching {
+			matchingCommits = append(matchingCommits, c)
+		}
+	}
+
+	return matchingCommits, rows.Err()
+}
+
+func (s *SQLiteStore) GetEventTypes(ctx context.Context) ([]analytics.EventType, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT type FROM events ORDER BY type`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var types []analytics.EventType
+	for rows.Next() {
+		var t analytics.EventType
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	return types, rows.Err()
+}
+
+// maxQueryParams bounds the number of IDs bound to a single IN query.
+const maxQueryParams = 500
+
+// queryByIDs runs query, which must hold an IN clause placeholder "(%s)",
+// once per chunk of ids, calling scan for every row returned.
+func (s *SQLiteStore) queryByIDs(ctx context.Context, query string, ids []uint64, scan func(*sql.Rows) error) error {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = int64(id)
+	}
+	return s.queryIn(ctx, query, args, scan)
+}
+
+// queryIn runs query, which must hold an IN clause placeholder "(%s)", once
+// per chunk of args, calling scan for every row returned.
+func (s *SQLiteStore) queryIn(ctx context.Context, query string, args []interface{}, scan func(*sql.Rows) error) error {
+	for start := 0; start < len(args); start += maxQueryParams {
+		end := start + maxQueryParams
+		if end > len(args) {
+			end = len(args)
+		}
+
+		chunk := args[start:end]
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", ")
+
+		rows, err := s.db.QueryContext(ctx, fmt.Sprintf(query, placeholders), chunk...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) GetUsersByIDs(ctx context.Context, ids []uint64) ([]analytics.Actor, error) {
+	usersByID := make(map[uint64]analytics.Actor, len(ids))
+	err := s.queryByIDs(ctx, `SELECT id, username FROM actors WHERE id IN (%s)`, ids,
+		func(rows *sql.Rows) error {
+			var u analytics.Actor
+			if err := rows.Scan(&u.ID, &u.Username); err != nil {
+				return err
+			}
+			usersByID[u.ID] = u
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]analytics.Actor, 0, len(usersByID))
+	for _, id := range ids {
+		if u, ok := usersByID[id]; ok {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (s *SQLiteStore) GetReposByIDs(ctx context.Context, ids []uint64) ([]analytics.Repo, error) {
+	reposByID := make(map[uint64]analytics.Repo, len(ids))
+	err := s.queryByIDs(ctx, `SELECT id, name FROM repos WHERE id IN (%s)`, ids,
+		func(rows *sql.Rows) error {
+			var r analytics.Repo
+			if err := rows.Scan(&r.ID, &r.Name); err != nil {
+				return err
+			}
+			reposByID[r.ID] = r
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]analytics.Repo, 0, len(reposByID))
+	for _, id := range ids {
+		if r, ok := reposByID[id]; ok {
+			repos = append(repos, r)
+		}
+	}
+	return repos, nil
+}
+
+func (s *SQLiteStore) GetUsersByNames(ctx context.Context, names []string) ([]analytics.Actor, error) {
+	usersByName := make(map[string][]analytics.Actor, len(names))
+	err := s.queryIn(ctx, `SELECT id, username FROM actors WHERE username COLLATE NOCASE IN (%s) ORDER BY rowid`,
+		lowerNames(names), func(rows *sql.Rows) error {
+			var u analytics.Actor
+			if err := rows.Scan(&u.ID, &u.Username); err != nil {
+				return err
+			}
+			name := strings.ToLower(u.Username)
+			usersByName[name] = append(usersByName[name], u)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var users []analytics.Actor
+	for _, name := range names {
+		users = append(users, usersByName[strings.ToLower(name)]...)
+	}
+	return users, nil
+}
+
+func (s *SQLiteStore) GetReposByNames(ctx context.Context, names []string) ([]analytics.Repo, error) {
+	reposByName := make(map[string][]analytics.Repo, len(names))
+	err := s.queryIn(ctx, `SELECT id, name FROM repos WHERE name COLLATE NOCASE IN (%s) ORDER BY rowid`,
+		lowerNames(names), func(rows *sql.Rows) error {
+			var r analytics.Repo
+			if err := rows.Scan(&r.ID, &r.Name); err != nil {
+				return err
+			}
+			name := strings.ToLower(r.Name)
+			reposByName[name] = append(reposByName[name], r)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []analytics.Repo
+	for _, name := range names {
+		repos = append(repos, reposByName[strings.ToLower(name)]...)
+	}
+	return repos, nil
+}
+
+// lowerNames returns the names lowercased as query arguments.
+func lowerNames(names []string) []interface{} {
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = strings.ToLower(name)
+	}
+	return args
+}
+
+func (s *SQLiteStore) GetCommitsByEventIDs(ctx context.Context, eventIDs []uint64) ([]analytics.Commit, error) {
+	var commits []analytics.Commit
+	err := s.queryByIDs(ctx, `SELECT sha, message, event_id FROM commits WHERE event_id IN (%s) ORDER BY rowid`,
+		eventIDs, func(rows *sql.Rows) error {
+			var c analytics.Commit
+			if err := rows.Scan(&c.Sha, &c.Message, &c.EventID); err != nil {
+				return err
+			}
+			commits = append(commits, c)
+			return nil
+		})
+	return commits, err
+}
@@ -0,0 +1,124 @@
+package data_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dikaeinstein/ghanalytics/analytics"
+	"github.com/dikaeinstein/ghanalytics/data"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	src, err := data.NewStore(
+		strings.NewReader("id,username\n1,alice\n2,bob"),
+		strings.NewReader("sha,message,event_id\na1,first,100\na2,second,100\nb1,third,102"),
+		strings.NewReader(`id,type,actor_id,repo_id,created_at
+100,PushEvent,1,10,2020-01-01T15:00:00Z
+101,WatchEvent,2,10,2020-01-01T15:30:00Z
+102,PushEvent,2,20,2020-01-01T16:00:00Z
+103,PullRequestEvent,1,20,`),
+		strings.NewReader("id,name\n10,alice/ten\n20,bob/twenty"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "gh.db")
+	store, err := data.OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// Importing twice must not duplicate rows
+	for i := 0; i < 2; i++ {
+		if err := store.Import(src); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts, err := store.RowCounts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (data.RowCounts{Actors: 2, Commits: 3, Events: 4, Repos: 2}); counts != want {
+		t.Errorf("Wrong row counts returned. want %+v; got %+v", want, counts)
+	}
+
+	all := func(analytics.Event) bool { return true }
+	wantEvents, _ := src.GetEvents(all)
+	gotEvents, err := store.GetEvents(all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotEvents, wantEvents) {
+		t.Errorf("Wrong events returned. want %+v; got %+v", wantEvents, gotEvents)
+	}
+
+	wantCommits, _ := src.GetCommits(func(analytics.Commit) bool { return true })
+	gotCommits, err := store.GetCommits(func(analytics.Commit) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotCommits, wantCommits) {
+		t.Errorf("Wrong commits returned. want %+v; got %+v", wantCommits, gotCommits)
+	}
+
+	at := func(hour, min int) time.Time {
+		return time.Date(2020, 1, 1, hour, min, 0, 0, time.UTC)
+	}
+
+	filters := []struct {
+		desc     string
+		filter   analytics.EventFilter
+		expected []uint64
+	}{
+		{desc: "All", expected: []uint64{100, 101, 102, 103}},
+		{desc: "By type", filter: analytics.EventFilter{Types: []analytics.EventType{analytics.PushEvent, analytics.WatchEvent}}, expected: []uint64{100, 101, 102}},
+		{desc: "By actor", filter: analytics.EventFilter{ActorID: 1}, expected: []uint64{100, 103}},
+		{desc: "By repo and type", filter: analytics.EventFilter{RepoID: 20, Types: []analytics.EventType{analytics.PushEvent}}, expected: []uint64{102}},
+		{desc: "By window", filter: analytics.EventFilter{Since: at(15, 15), Until: at(16, 0)}, expected: []uint64{101}},
+	}
+
+	for _, f := range filters {
+		t.Run(f.desc, func(t *testing.T) {
+			events, err := queryEvents(store, f.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids := make([]uint64, len(events))
+			for i, e := range events {
+				ids[i] = e.ID
+				if !f.filter.Match(e) {
+					t.Errorf("event %+v does not match filter %+v", e, f.filter)
+				}
+			}
+			if !reflect.DeepEqual(ids, f.expected) {
+				t.Errorf("Wrong events returned. want %v; got %v", f.expected, ids)
+			}
+		})
+	}
+
+	wantUsers, err := analytics.New(src).ListUsers(
+		analytics.Sort([]analytics.SortCriteria{analytics.CommitsPushed, analytics.PrCreated}),
+		analytics.Limit(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotUsers, err := analytics.New(store).ListUsers(
+		analytics.Sort([]analytics.SortCriteria{analytics.CommitsPushed, analytics.PrCreated}),
+		analytics.Limit(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotUsers, wantUsers) {
+		t.Errorf("Wrong users ranked. want %+v; got %+v", wantUsers, gotUsers)
+	}
+}
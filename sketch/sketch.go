@@ -0,0 +1,254 @@
+// Package sketch provides fixed size probabilistic summaries of streams of
+// uint64 keys, trading exactness for memory that stays the same however
+// many keys are added.
+package sketch
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// mix scrambles x into a uniformly distributed hash, as the finalizer of
+// SplitMix64 does.
+func mix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// CountMin is a Count-Min Sketch estimating how much was added to each key.
+// Estimates never fall below the exact amount, and exceed it by at most
+// ErrorBound with the probability given to NewCountMin.
+type CountMin struct {
+	epsilon float64
+	width   uint64
+	rows    [][]uint64
+	total   uint64
+}
+
+// NewCountMin returns a CountMin whose estimates exceed the exact amounts by
+// at most epsilon times the Total added, with probability 1-delta. It panics
+// unless both are between 0 and 1.
+func NewCountMin(epsilon, delta float64) *CountMin {
+	if epsilon <= 0 || epsilon >= 1 || delta <= 0 || delta >= 1 {
+		panic("sketch: epsilon and delta must be between 0 and 1")
+	}
+
+	width := uint64(math.Ceil(math.E / epsilon))
+	depth := int(math.Ceil(math.Log(1 / delta)))
+	rows := make([][]uint64, depth)
+	for i := range rows {
+		rows[i] = make([]uint64, width)
+	}
+
+	return &CountMin{epsilon: epsilon, width: width, rows: rows}
+}
+
+// cell returns the position of key within row i, derived from two halves of
+// a single hash.
+func (c *CountMin) cell(key uint64, i int) uint64 {
+	h := mix(key)
+	h1, h2 := h&math.MaxUint32, h>>32|1
+	return (h1 + uint64(i)*h2) % c.width
+}
+
+// Add adds n to the amount of key.
+func (c *CountMin) Add(key, n uint64) {
+	for i, row := range c.rows {
+		row[c.cell(key, i)] += n
+	}
+	c.total += n
+}
+
+// Count returns the estimated amount of key.
+func (c *CountMin) Count(key uint64) uint64 {
+	estimate := uint64(math.MaxUint64)
+	for i, row := range c.rows {
+		if n := row[c.cell(key, i)]; n < estimate {
+			estimate = n
+		}
+	}
+	return estimate
+}
+
+// Total returns the amount added to every key.
+func (c *CountMin) Total() uint64 {
+	return c.total
+}
+
+// ErrorBound returns how much an estimate may exceed the exact amount.
+func (c *CountMin) ErrorBound() uint64 {
+	return uint64(math.Ceil(c.epsilon * float64(c.total)))
+}
+
+// Counter is the estimated amount of a key tracked by SpaceSaving. Count
+// exceeds the exact amount by at most Error.
+type Counter struct {
+	Key   uint64
+	Count uint64
+	Error uint64
+}
+
+// SpaceSaving tracks the heavy hitters of a stream, the keys with the
+// largest amounts, in a fixed number of counters. Once every counter is in
+// use, a new key takes over the counter of the smallest amount, inheriting
+// it as its error. Any key whose exact amount exceeds Total divided by the
+// number of counters is guaranteed to be tracked.
+type SpaceSaving struct {
+	capacity int
+	counters []Counter
+	index    map[uint64]int
+	total    uint64
+}
+
+// preallocCounters bounds the counters a SpaceSaving allocates up front, the
+// others being allocated as keys come in.
+const preallocCounters = 1024
+
+// NewSpaceSaving returns a SpaceSaving tracking up to capacity keys, or an
+// error unless capacity is positive. Counters are allocated as keys are
+// added, so memory grows with the keys tracked rather than capacity.
+func NewSpaceSaving(capacity int) (*SpaceSaving, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("sketch: invalid capacity %d: must be positive", capacity)
+	}
+
+	prealloc := capacity
+	if prealloc > preallocCounters {
+		prealloc = preallocCounters
+	}
+	return &SpaceSaving{
+		capacity: capacity,
+		counters: make([]Counter, 0, prealloc),
+		index:    make(map[uint64]int, prealloc),
+	}, nil
+}
+
+// Add adds n to the amount of key. Adding zero to a key not tracked once
+// every counter is in use leaves the counters untouched.
+func (s *SpaceSaving) Add(key, n uint64) {
+	s.total += n
+
+	if i, ok := s.index[key]; ok {
+		s.counters[i].Count += n
+		heap.Fix((*counterHeap)(s), i)
+		return
+	}
+	if len(s.counters) < s.capacity {
+		heap.Push((*counterHeap)(s), Counter{Key: key, Count: n})
+		return
+	}
+	if n == 0 {
+		return
+	}
+
+	smallest := s.counters[0]
+	delete(s.index, smallest.Key)
+	s.counters[0] = Counter{Key: key, Count: smallest.Count + n, Error: smallest.Count}
+	s.index[key] = 0
+	heap.Fix((*counterHeap)(s), 0)
+}
+
+// Counters returns the tracked keys, largest amounts first, ties being
+// ordered by key.
+func (s *SpaceSaving) Counters() []Counter {
+	counters := append([]Counter(nil), s.counters...)
+	sort.Slice(counters, func(i, j int) bool {
+		if counters[i].Count != counters[j].Count {
+			return counters[i].Count > counters[j].Count
+		}
+		return counters[i].Key < counters[j].Key
+	})
+	return counters
+}
+
+// Total returns the amount added to every key.
+func (s *SpaceSaving) Total() uint64 {
+	return s.total
+}
+
+// counterHeap implements heap.Interface over the counters of a SpaceSaving,
+// the smallest amount at the root, keeping its index up to date.
+type counterHeap SpaceSaving
+
+func (h *counterHeap) Len() int { return len(h.counters) }
+
+func (h *counterHeap) Less(i, j int) bool { return h.counters[i].Count < h.counters[j].Count }
+
+func (h *counterHeap) Swap(i, j int) {
+	h.counters[i], h.counters[j] = h.counters[j], h.counters[i]
+	h.index[h.counters[i].Key] = i
+	h.index[h.counters[j].Key] = j
+}
+
+func (h *counterHeap) Push(x any) {
+	c := x.(Counter)
+	h.index[c.Key] = len(h.counters)
+	h.counters = append(h.counters, c)
+}
+
+func (h *counterHeap) Pop() any {
+	last := h.counters[len(h.counters)-1]
+	h.counters = h.counters[:len(h.counters)-1]
+	delete(h.index, last.Key)
+	return last
+}
+
+// HyperLogLog estimates the number of distinct keys added, within a
+// relative StdError, in 2^precision bytes.
+type HyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+// NewHyperLogLog returns a HyperLogLog of 2^precision registers. It panics
+// unless precision is between 4 and 18.
+func NewHyperLogLog(precision uint8) *HyperLogLog {
+	if precision < 4 || precision > 18 {
+		panic("sketch: precision must be between 4 and 18")
+	}
+
+	return &HyperLogLog{precision: precision, registers: make([]uint8, 1<<precision)}
+}
+
+// Add adds key to the set of keys counted.
+func (h *HyperLogLog) Add(key uint64) {
+	hash := mix(key)
+	i := hash >> (64 - h.precision)
+	// the sentinel bit bounds the rank when the remaining bits are zero
+	w := hash<<h.precision | 1<<(h.precision-1)
+	if rank := uint8(bits.LeadingZeros64(w) + 1); rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+// Count returns the estimated number of distinct keys added.
+func (h *HyperLogLog) Count() uint64 {
+	m := float64(len(h.registers))
+
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+	// small cardinalities are better estimated by counting empty registers
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(math.Round(estimate))
+}
+
+// StdError returns the relative standard error of Count.
+func (h *HyperLogLog) StdError() float64 {
+	return 1.04 / math.Sqrt(float64(len(h.registers)))
+}
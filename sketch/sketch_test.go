@@ -0,0 +1,158 @@
+package sketch_test
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/dikaeinstein/ghanalytics/sketch"
+)
+
+// zipfStream returns n keys following a Zipf distribution over keys, as
+// the activity of users does, along with their exact amounts.
+func zipfStream(n int, keys uint64) ([]uint64, map[uint64]uint64) {
+	rnd := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(rnd, 1.2, 1, keys-1)
+
+	stream := make([]uint64, n)
+	exact := make(map[uint64]uint64)
+	for i := range stream {
+		stream[i] = zipf.Uint64()
+		exact[stream[i]]++
+	}
+	return stream, exact
+}
+
+func TestCountMin(t *testing.T) {
+	stream, exact := zipfStream(200_000, 50_000)
+
+	cm := sketch.NewCountMin(0.001, 0.01)
+	for _, key := range stream {
+		cm.Add(key, 1)
+	}
+
+	if cm.Total() != uint64(len(stream)) {
+		t.Errorf("Wrong total returned. want %d; got %d", len(stream), cm.Total())
+	}
+
+	bound := cm.ErrorBound()
+	if bound != 200 {
+		t.Errorf("Wrong error bound returned. want 200; got %d", bound)
+	}
+
+	exceeded := 0
+	for key, n := range exact {
+		got := cm.Count(key)
+		if got < n {
+			t.Fatalf("Count(%d) underestimates. want at least %d; got %d", key, n, got)
+		}
+		if got-n > bound {
+			exceeded++
+		}
+	}
+	if share := float64(exceeded) / float64(len(exact)); share > 0.01 {
+		t.Errorf("%.2f%% of the estimates exceed the error bound, want at most 1%%", share*100)
+	}
+}
+
+func TestSpaceSavingExactWithinCapacity(t *testing.T) {
+	ss, err := sketch.NewSpaceSaving(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range [][2]uint64{{3, 2}, {1, 5}, {2, 2}, {3, 1}, {4, 0}} {
+		ss.Add(kv[0], kv[1])
+	}
+
+	want := []sketch.Counter{
+		{Key: 1, Count: 5},
+		{Key: 3, Count: 3},
+		{Key: 2, Count: 2},
+		{Key: 4, Count: 0},
+	}
+	if got := ss.Counters(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong counters returned. want %+v; got %+v", want, got)
+	}
+	if ss.Total() != 10 {
+		t.Errorf("Wrong total returned. want 10; got %d", ss.Total())
+	}
+}
+
+func TestSpaceSavingCapacity(t *testing.T) {
+	if _, err := sketch.NewSpaceSaving(0); err == nil {
+		t.Error("expected error for zero capacity; got nil")
+	}
+
+	// counters are allocated as keys come in, whatever the capacity
+	ss, err := sketch.NewSpaceSaving(math.MaxInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.Add(1, 2)
+	if got := ss.Counters(); len(got) != 1 || got[0].Count != 2 {
+		t.Errorf("Wrong counters returned. want [{Key:1 Count:2}]; got %+v", got)
+	}
+}
+
+func TestSpaceSavingHeavyHitters(t *testing.T) {
+	stream, exact := zipfStream(200_000, 50_000)
+
+	const capacity = 100
+	ss, err := sketch.NewSpaceSaving(capacity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range stream {
+		ss.Add(key, 1)
+	}
+
+	counters := ss.Counters()
+	if len(counters) != capacity {
+		t.Fatalf("Wrong number of counters returned. want %d; got %d", capacity, len(counters))
+	}
+
+	tracked := make(map[uint64]bool)
+	for _, c := range counters {
+		tracked[c.Key] = true
+		n := exact[c.Key]
+		if c.Count < n || c.Count-c.Error > n {
+			t.Errorf("Counter %+v does not bound the exact amount %d", c, n)
+		}
+	}
+
+	threshold := ss.Total() / capacity
+	for key, n := range exact {
+		if n > threshold && !tracked[key] {
+			t.Errorf("Heavy hitter %d with amount %d is not tracked", key, n)
+		}
+	}
+}
+
+func TestHyperLogLog(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		distinct int
+	}{
+		{desc: "Small", distinct: 100},
+		{desc: "Medium", distinct: 10_000},
+		{desc: "Large", distinct: 1_000_000},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			hll := sketch.NewHyperLogLog(14)
+			for i := 0; i < tC.distinct; i++ {
+				// every key is added twice, duplicates must not count
+				hll.Add(uint64(i))
+				hll.Add(uint64(i))
+			}
+
+			got := float64(hll.Count())
+			want := float64(tC.distinct)
+			if relErr := math.Abs(got-want) / want; relErr > 3*hll.StdError() {
+				t.Errorf("Count off by %.2f%%. want %v; got %v", relErr*100, want, got)
+			}
+		})
+	}
+}